@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+
+	"github.com/pires/go-proxyproto"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Counter for requests deliberately aborted mid-response
+	httpAbortedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_aborted_total",
+			Help: "Total number of requests aborted mid-response by ABORT_RATE, by path",
+		},
+		[]string{"path"},
+	)
+
+	// Fraction of app requests aborted with a connection reset, from ABORT_RATE
+	abortRate float64
+)
+
+// Abort a random ABORT_RATE fraction of requests before the handler runs:
+// send a status line and part of a body, then reset the connection, as a
+// crashing peer or flaky network would. Aborted requests are counted in
+// http_aborted_total rather than the HTTP metrics, which have no status for them.
+func abortRandomly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if abortRate <= 0 || rand.Float64() >= abortRate {
+			next.ServeHTTP(w, r)
+			return
+		}
+		httpAbortedTotal.WithLabelValues(r.URL.Path).Inc()
+
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			// HTTP/2 cannot be hijacked; aborting the handler resets the stream
+			panic(http.ErrAbortHandler)
+		}
+		fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 1024\r\n\r\npartial")
+		buf.Flush()
+		// A zero linger makes Close send RST instead of FIN. Closing the socket
+		// itself also skips TLS's close_notify, which clients read as a clean EOF.
+		if tcp, ok := unwrapConn(conn).(*net.TCPConn); ok {
+			tcp.SetLinger(0)
+			tcp.Close()
+			return
+		}
+		conn.Close()
+	})
+}
+
+// Peel the listener wrappers off a connection to reach the TCP socket
+func unwrapConn(c net.Conn) net.Conn {
+	for {
+		switch wrapped := c.(type) {
+		case *idleConn:
+			c = wrapped.Conn
+		case *proxyproto.Conn:
+			c = wrapped.Raw()
+		case *tls.Conn:
+			c = wrapped.NetConn()
+		default:
+			return c
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+)
+
+// Aborted requests reach the client as a reset connection or stream and are
+// counted per path; probes are never aborted
+func TestAbortRandomly(t *testing.T) {
+	setAtomic(t, &apiLatency, 0)
+	tests := []struct {
+		name    string
+		path    string
+		rate    float64
+		tls     bool
+		http2   bool
+		aborted bool
+	}{
+		{"abort everything", "/api", 1, false, false, true},
+		{"abort nothing", "/api", 0, false, false, false},
+		{"probe", "/health", 1, false, false, false},
+		{"https", "/api", 1, true, false, true},
+		{"http2 stream", "/api", 1, true, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setVar(t, &abortRate, tt.rate)
+			srv := httptest.NewUnstartedServer(newTestRouter(t))
+			if tt.tls {
+				srv.EnableHTTP2 = tt.http2
+				srv.StartTLS()
+			} else {
+				srv.Start()
+			}
+			t.Cleanup(srv.Close)
+			before := metricValue(t, httpAbortedTotal.WithLabelValues(tt.path))
+
+			resp, err := srv.Client().Get(srv.URL + tt.path)
+			if err == nil {
+				if resp.ProtoMajor == 2 != tt.http2 {
+					t.Fatalf("served over %s, want HTTP/2 %v", resp.Proto, tt.http2)
+				}
+				_, err = io.ReadAll(resp.Body)
+				resp.Body.Close()
+			}
+			if tt.aborted {
+				if err == nil {
+					t.Errorf("request completed, want it aborted")
+				} else if !tt.http2 && !errors.Is(err, syscall.ECONNRESET) {
+					t.Errorf("error %v, want a connection reset", err)
+				}
+			} else if err != nil || resp.StatusCode != http.StatusOK {
+				t.Errorf("request failed: %v", err)
+			}
+
+			want := 0.0
+			if tt.aborted {
+				want = 1
+			}
+			if got := metricValue(t, httpAbortedTotal.WithLabelValues(tt.path)) - before; got != want {
+				t.Errorf("http_aborted_total grew by %g, want %g", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Access log formats accepted by ACCESS_LOG_FORMAT
+const (
+	accessLogJSON     = "json"
+	accessLogCombined = "combined"
+)
+
+var (
+	// Per-request access log format; empty disables access logging
+	accessLogFormat string
+
+	// Destination of combined-format lines, kept apart from the JSON logs on stderr
+	combinedLog = log.New(os.Stdout, "", 0)
+)
+
+func validAccessLogFormat(format string) error {
+	switch format {
+	case "", accessLogJSON, accessLogCombined:
+		return nil
+	}
+	return fmt.Errorf("unknown format %q, want %s or %s", format, accessLogJSON, accessLogCombined)
+}
+
+// Log one request in the configured format
+func logAccess(r *http.Request, rw *responseWriter, start time.Time, duration time.Duration) {
+	switch accessLogFormat {
+	case accessLogJSON:
+		slog.Info("Request",
+			"remote_addr", r.RemoteAddr,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rw.statusCode,
+			"bytes", rw.bytes,
+			"duration_seconds", duration.Seconds(),
+		)
+	case accessLogCombined:
+		combinedLog.Print(combinedLine(r, rw, start, duration))
+	}
+}
+
+// Apache combined log format, with the duration in microseconds (%D) appended:
+// host ident user [time] "request" status bytes "referer" "user-agent" micros
+func combinedLine(r *http.Request, rw *responseWriter, start time.Time, duration time.Duration) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	user := "-"
+	if name, _, ok := r.BasicAuth(); ok && name != "" {
+		user = name
+	}
+	size := "-"
+	if rw.bytes > 0 {
+		size = fmt.Sprint(rw.bytes)
+	}
+	return fmt.Sprintf("%s - %s [%s] %q %d %s %q %q %d",
+		host, user, start.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method+" "+r.RequestURI+" "+r.Proto, rw.statusCode, size,
+		orDash(r.Referer()), orDash(r.UserAgent()), duration.Microseconds())
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Counter for handler panics recovered by recoverMiddleware
+	httpPanicsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_panics_total",
+			Help: "Total number of recovered handler panics",
+		},
+		[]string{"path"},
+	)
+
+	// Token guarding /admin endpoints, from ADMIN_TOKEN; empty leaves them open
+	adminToken string
+)
+
+// Turn a handler panic into a 500 so one bad request cannot take the server down
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			// ErrAbortHandler deliberately aborts the response; let net/http handle it
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			httpPanicsTotal.WithLabelValues(r.URL.Path).Inc()
+			events.add(eventPanicRecovered, "Handler panic recovered", "path", r.URL.Path, "panic", fmt.Sprint(err))
+			slog.Error("Handler panic recovered", "path", r.URL.Path, "panic", err, "stack", string(debug.Stack()))
+			writeJSONError(w, http.StatusInternalServerError, "internal server error")
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Require the admin token when one is configured
+func adminAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if adminToken != "" && !tokenCredentials(adminToken).matches(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Like adminAuth, but refuse outright when no admin token is configured;
+// used for endpoints that must never be reachable by accident
+func adminOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if adminToken == "" {
+			writeJSONError(w, http.StatusForbidden, "ADMIN_TOKEN is not configured")
+			return
+		}
+		adminAuth(next)(w, r)
+	}
+}
+
+// Deliberately panic to exercise the recovery path end to end
+func adminPanicHandler(w http.ResponseWriter, r *http.Request) {
+	panic("panic requested via /admin/panic")
+}
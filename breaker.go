@@ -0,0 +1,165 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Circuit breaker states, also the values of the circuit_breaker_state gauge
+const (
+	breakerClosed   = 0
+	breakerOpen     = 1
+	breakerHalfOpen = 2
+)
+
+var (
+	// Gauge for the downstream circuit breaker state
+	circuitBreakerState = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "circuit_breaker_state",
+			Help: "Downstream circuit breaker state (0 closed, 1 open, 2 half-open)",
+		},
+	)
+)
+
+// Settings for the downstream circuit breaker
+type breakerConfig struct {
+	// Breaker short-circuits /api while open
+	enabled bool
+	// Number of most recent calls the error rate is computed over
+	window int
+	// Minimum calls in the window before the breaker may trip
+	minRequests int
+	// Error rate at or above which the breaker trips
+	errorThreshold float64
+	// Time the breaker stays open before letting a probe through
+	openDuration time.Duration
+}
+
+// Circuit breaker around the simulated downstream. Closed, it records
+// outcomes and trips open once the error rate in the window reaches the
+// threshold. Open, it rejects calls until openDuration passes, then goes
+// half-open and lets a single probe through: success closes it, failure
+// opens it again.
+type circuitBreaker struct {
+	cfg breakerConfig
+
+	mu       sync.Mutex
+	state    int
+	outcomes []bool // ring of recent outcomes, true means failure
+	next     int
+	filled   int
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(cfg breakerConfig) *circuitBreaker {
+	if cfg.window < 1 {
+		cfg.window = 1
+	}
+	return &circuitBreaker{cfg: cfg, outcomes: make([]bool, cfg.window)}
+}
+
+// Report whether a call may proceed; callers that get true must call record,
+// or release when the outcome is unknown
+func (b *circuitBreaker) allow() bool {
+	if !b.cfg.enabled {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cfg.openDuration {
+			return false
+		}
+		b.setState(breakerHalfOpen)
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		// Only one probe at a time
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Record the outcome of a call that was allowed
+func (b *circuitBreaker) record(failed bool) {
+	if !b.cfg.enabled {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen {
+		b.probing = false
+		if failed {
+			b.trip()
+		} else {
+			b.reset()
+		}
+		return
+	}
+	if b.state != breakerClosed {
+		return
+	}
+
+	if b.filled == len(b.outcomes) && b.outcomes[b.next] {
+		b.failures--
+	}
+	b.outcomes[b.next] = failed
+	if failed {
+		b.failures++
+	}
+	b.next = (b.next + 1) % len(b.outcomes)
+	if b.filled < len(b.outcomes) {
+		b.filled++
+	}
+
+	if b.filled >= b.cfg.minRequests && float64(b.failures)/float64(b.filled) >= b.cfg.errorThreshold {
+		b.trip()
+	}
+}
+
+// Give back an allowed call without recording an outcome, such as one the
+// client cancelled; a half-open probe is freed so the next call can probe
+func (b *circuitBreaker) release() {
+	if !b.cfg.enabled {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen {
+		b.probing = false
+	}
+}
+
+func (b *circuitBreaker) trip() {
+	b.openedAt = time.Now()
+	b.setState(breakerOpen)
+}
+
+// Close the breaker and forget previous outcomes
+func (b *circuitBreaker) reset() {
+	clear(b.outcomes)
+	b.next, b.filled, b.failures = 0, 0, 0
+	b.setState(breakerClosed)
+}
+
+func (b *circuitBreaker) setState(state int) {
+	b.state = state
+	circuitBreakerState.Set(float64(state))
+}
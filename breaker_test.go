@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerTrips(t *testing.T) {
+	tests := []struct {
+		name     string
+		outcomes []bool // true means failure
+		want     int
+	}{
+		{"below min requests", []bool{true, true}, breakerClosed},
+		{"below threshold", []bool{false, false, false, true}, breakerClosed},
+		{"at threshold", []bool{false, true, false, true}, breakerOpen},
+		{"old failures roll out", []bool{false, true, false, false, false, false, true}, breakerClosed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newCircuitBreaker(breakerConfig{enabled: true, window: 4, minRequests: 3, errorThreshold: 0.5, openDuration: time.Hour})
+			for _, failed := range tt.outcomes {
+				if !b.allow() {
+					t.Fatal("call rejected before the breaker should have tripped")
+				}
+				b.record(failed)
+			}
+			if b.state != tt.want {
+				t.Errorf("state = %d, want %d", b.state, tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	tests := []struct {
+		name  string
+		probe func(b *circuitBreaker)
+		want  int
+	}{
+		{"successful probe closes", func(b *circuitBreaker) { b.record(false) }, breakerClosed},
+		{"failed probe reopens", func(b *circuitBreaker) { b.record(true) }, breakerOpen},
+		{"released probe stays half-open", func(b *circuitBreaker) { b.release() }, breakerHalfOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newCircuitBreaker(breakerConfig{enabled: true, window: 1, minRequests: 1, errorThreshold: 0.5, openDuration: time.Millisecond})
+			b.record(true)
+			if b.allow() {
+				t.Fatal("open breaker allowed a call")
+			}
+			time.Sleep(2 * time.Millisecond)
+			if !b.allow() {
+				t.Fatal("breaker did not let a probe through after openDuration")
+			}
+			if b.allow() {
+				t.Fatal("breaker allowed a second concurrent probe")
+			}
+			tt.probe(b)
+			if b.state != tt.want {
+				t.Errorf("state = %d, want %d", b.state, tt.want)
+			}
+		})
+	}
+}
+
+// A probe whose client disconnects must not leave the breaker stuck half-open
+func TestCircuitBreakerCancelledProbe(t *testing.T) {
+	setVar(t, &downstream, downstreamConfig{calls: 1, latency: time.Millisecond})
+	setVar(t, &downstreamBreaker, newCircuitBreaker(breakerConfig{enabled: true, window: 1, minRequests: 1, errorThreshold: 0.5, openDuration: time.Millisecond}))
+	setAtomic(t, &apiLatency, 0)
+
+	downstreamBreaker.record(true)
+	time.Sleep(2 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	apiHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api", nil).WithContext(ctx))
+	if downstreamBreaker.state != breakerHalfOpen {
+		t.Fatalf("state after cancelled probe = %d, want half-open", downstreamBreaker.state)
+	}
+
+	rec := httptest.NewRecorder()
+	apiHandler(rec, httptest.NewRequest(http.MethodGet, "/api", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("probe after cancellation: status %d, body %s", rec.Code, rec.Body)
+	}
+	if downstreamBreaker.state != breakerClosed {
+		t.Errorf("state after successful probe = %d, want closed", downstreamBreaker.state)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultBurnDuration = 100 * time.Millisecond
+	maxBurnDuration     = 10 * time.Second
+)
+
+var (
+	// Gauge for burns currently running inside the bulkhead
+	burnActive = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "burn_active",
+			Help: "Number of CPU burns currently running",
+		},
+	)
+
+	// Counter for burns rejected because the bulkhead was full
+	burnRejectedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "burn_rejected_total",
+			Help: "Total number of CPU burns rejected by the bulkhead",
+		},
+	)
+
+	// Counter for requests that shared another request's burn
+	singleflightSharedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "singleflight_shared_total",
+			Help: "Total number of requests served by an identical in-flight computation",
+		},
+	)
+
+	// Bulkhead slots; at most cap(burnSlots) burns run concurrently
+	burnSlots = make(chan struct{}, runtime.NumCPU())
+
+	// Share one burn between concurrent identical /burn requests, from BURN_COALESCE
+	burnCoalesce bool
+	burnGroup    singleflight.Group
+)
+
+// CPU indices burn workers are pinned to, from BURN_PIN_CPUS; empty means float
+var burnPinCPUs []int
+
+// Parse a comma-separated list of CPU indices such as "0,2,3"
+func parseCPUList(value string) ([]int, error) {
+	var cpus []int
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		cpu, err := strconv.Atoi(field)
+		if err != nil || cpu < 0 {
+			return nil, fmt.Errorf("invalid CPU index %q", field)
+		}
+		cpus = append(cpus, cpu)
+	}
+	return cpus, nil
+}
+
+// Spin on the CPU until the deadline passes
+func burnCPU(deadline time.Time) {
+	x := 0
+	for time.Now().Before(deadline) {
+		for i := 0; i < 1000; i++ {
+			x += i * i
+		}
+	}
+	_ = x
+}
+
+// Run one burn worker, pinned to a CPU when pinning is configured
+func burnWorker(ctx context.Context, id int, deadline time.Time) {
+	defer trackCPU(ctx)()
+	if len(burnPinCPUs) > 0 {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		if err := pinToCPU(burnPinCPUs[id%len(burnPinCPUs)]); err != nil {
+			// Best effort: keep burning on whatever CPU we got
+			logPinFailure(err)
+		}
+	}
+	burnCPU(deadline)
+}
+
+var pinFailureOnce sync.Once
+
+func logPinFailure(err error) {
+	pinFailureOnce.Do(func() {
+		log.Printf("CPU pinning failed, burn workers will float: %v", err)
+	})
+}
+
+var errBurnBulkheadFull = errors.New("too many concurrent burns")
+
+// Burn for duration on workers goroutines inside the bulkhead. It rejects
+// rather than queues so burns cannot starve other handlers.
+func burn(r *http.Request, duration time.Duration, workers int) error {
+	select {
+	case burnSlots <- struct{}{}:
+	default:
+		return errBurnBulkheadFull
+	}
+	burnActive.Inc()
+	defer func() {
+		burnActive.Dec()
+		<-burnSlots
+	}()
+
+	start := time.Now()
+	deadline := start.Add(duration)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			burnWorker(r.Context(), id, deadline)
+		}(i)
+	}
+	wg.Wait()
+	observeWork(r, start)
+	return nil
+}
+
+// CPU burn endpoint: /burn?duration=500ms&workers=2
+func burnHandler(w http.ResponseWriter, r *http.Request) {
+	duration := defaultBurnDuration
+	if v := r.URL.Query().Get("duration"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxBurnDuration {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("duration must be between 0 and %s", maxBurnDuration))
+			return
+		}
+		duration = d
+	}
+
+	workers := 1
+	if v := r.URL.Query().Get("workers"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > runtime.NumCPU() {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("workers must be between 1 and %d", runtime.NumCPU()))
+			return
+		}
+		workers = n
+	}
+
+	var err error
+	executed := false
+	if burnCoalesce {
+		// Identical concurrent requests wait for the first one's burn
+		_, err, _ = burnGroup.Do(fmt.Sprintf("%s/%d", duration, workers), func() (any, error) {
+			executed = true
+			return nil, burn(r, duration, workers)
+		})
+		if !executed {
+			singleflightSharedTotal.Inc()
+		}
+	} else {
+		err = burn(r, duration, workers)
+		executed = true
+	}
+	// Only the request that burned pays for it; shared results cost the default
+	if executed && err == nil {
+		setRequestCost(r, float64(time.Duration(workers)*duration)/float64(burnCostUnit))
+	}
+	if err != nil {
+		burnRejectedTotal.Inc()
+		writeShed(w, http.StatusTooManyRequests, "bulkhead_full", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":   "success",
+		"duration": duration.String(),
+		"workers":  workers,
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Burns past the bulkhead are rejected with 429 while the rest of the app
+// keeps answering promptly
+func TestBurnBulkhead(t *testing.T) {
+	setVar(t, &burnSlots, make(chan struct{}, 1))
+	setVar(t, &burnCoalesce, false)
+	setAtomic(t, &apiLatency, 0)
+	rt := newTestRouter(t)
+
+	done := make(chan int)
+	go func() { done <- serve(rt, http.MethodGet, "/burn?duration=300ms").Code }()
+	for deadline := time.Now().Add(time.Second); len(burnSlots) == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("burn never entered the bulkhead")
+		}
+	}
+	if got := metricValue(t, burnActive); got != 1 {
+		t.Errorf("burn_active %g, want 1", got)
+	}
+
+	rejected := metricValue(t, burnRejectedTotal)
+	tests := []struct {
+		target string
+		status int
+	}{
+		{"/burn?duration=10ms", http.StatusTooManyRequests},
+		{"/burn?duration=10ms&workers=1", http.StatusTooManyRequests},
+		{"/health", http.StatusOK},
+		{"/api", http.StatusOK},
+		{"/uptime", http.StatusOK},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		rec := serve(rt, http.MethodGet, tt.target)
+		if rec.Code != tt.status {
+			t.Errorf("%s during a full bulkhead: status %d, want %d", tt.target, rec.Code, tt.status)
+		}
+		if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+			t.Errorf("%s during a full bulkhead took %s", tt.target, elapsed)
+		}
+	}
+	if got := metricValue(t, burnRejectedTotal) - rejected; got != 2 {
+		t.Errorf("burn_rejected_total grew by %g, want 2", got)
+	}
+
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("admitted burn: status %d, want 200", code)
+	}
+	if got := metricValue(t, burnActive); got != 0 {
+		t.Errorf("burn_active %g after the burn, want 0", got)
+	}
+	if rec := serve(rt, http.MethodGet, "/burn?duration=10ms"); rec.Code != http.StatusOK {
+		t.Errorf("burn after the bulkhead emptied: status %d, want 200", rec.Code)
+	}
+}
+
+// Concurrent identical burns share one execution; with a single bulkhead
+// slot, any second execution would be rejected
+func TestBurnCoalescing(t *testing.T) {
+	tests := []struct {
+		name     string
+		coalesce bool
+		distinct bool // a different duration per request
+		slots    int
+		shared   float64
+		rejected bool
+	}{
+		{"identical requests", true, false, 1, 4, false},
+		{"distinct requests", true, true, 5, 0, false},
+		{"coalescing off", false, false, 1, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setVar(t, &burnCoalesce, tt.coalesce)
+			setVar(t, &burnSlots, make(chan struct{}, tt.slots))
+			shared := metricValue(t, singleflightSharedTotal)
+
+			var wg sync.WaitGroup
+			codes := make(chan int, 5)
+			for i := 0; i < 5; i++ {
+				d := 200
+				if tt.distinct {
+					d += i
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					codes <- serve(http.HandlerFunc(burnHandler), http.MethodGet, fmt.Sprintf("/burn?duration=%dms", d)).Code
+				}()
+			}
+			wg.Wait()
+			close(codes)
+
+			rejected := false
+			for code := range codes {
+				switch code {
+				case http.StatusOK:
+				case http.StatusTooManyRequests:
+					rejected = true
+				default:
+					t.Errorf("status %d", code)
+				}
+			}
+			if rejected != tt.rejected {
+				t.Errorf("some burns rejected = %v, want %v", rejected, tt.rejected)
+			}
+			if got := metricValue(t, singleflightSharedTotal) - shared; got != tt.shared {
+				t.Errorf("singleflight_shared_total grew by %g, want %g", got, tt.shared)
+			}
+		})
+	}
+}
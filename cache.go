@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Counter for cacheable requests, by path and result: hit or miss
+	httpCacheRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_cache_requests_total",
+			Help: "GET requests to cached paths, by result (hit, miss)",
+		},
+		[]string{"path", "result"},
+	)
+
+	// Paths whose GET responses are cached, from CACHE_PATHS; empty disables caching
+	cachePaths []string
+
+	// Response cache shared by all cached paths
+	responseCache = newLRUCache(1000, 10*time.Second)
+)
+
+// A cached 200 response
+type cachedResponse struct {
+	key     string
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// LRU cache of responses with a fixed TTL
+type lruCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+}
+
+func newLRUCache(size int, ttl time.Duration) *lruCache {
+	return &lruCache{size: size, ttl: ttl, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+// Cached response for key, if present and not expired
+func (c *lruCache) get(key string, now time.Time) (*cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	resp := el.Value.(*cachedResponse)
+	if now.After(resp.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return resp, true
+}
+
+// Store a response, evicting the least recently used entry when full
+func (c *lruCache) put(resp *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[resp.key]; ok {
+		el.Value = resp
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[resp.key] = c.order.PushFront(resp)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedResponse).key)
+	}
+}
+
+// Parse a comma-separated list, dropping empty entries
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Serve GETs from the cache when path is a cached path. Hits skip the handler,
+// and so its simulated latency; successful misses are stored.
+func cached(path string, next http.Handler) http.Handler {
+	if !slices.Contains(cachePaths, path) {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		now := time.Now()
+		key := r.URL.Path + "?" + r.URL.RawQuery
+		if resp, ok := responseCache.get(key, now); ok {
+			httpCacheRequestsTotal.WithLabelValues(path, "hit").Inc()
+			for k, v := range resp.header {
+				w.Header()[k] = v
+			}
+			w.Header().Set("X-Cache", "HIT")
+			w.WriteHeader(http.StatusOK)
+			w.Write(resp.body)
+			return
+		}
+
+		httpCacheRequestsTotal.WithLabelValues(path, "miss").Inc()
+		w.Header().Set("X-Cache", "MISS")
+		rec := &cacheRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if rec.status == http.StatusOK {
+			header := w.Header().Clone()
+			header.Del("X-Cache")
+			responseCache.put(&cachedResponse{key: key, header: header, body: rec.body.Bytes(), expires: now.Add(responseCache.ttl)})
+		}
+	})
+}
+
+// Response writer that copies the status and body while writing through
+type cacheRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *cacheRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *cacheRecorder) Write(b []byte) (int, error) {
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// Expose the underlying writer to http.ResponseController, for Flush
+func (rec *cacheRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
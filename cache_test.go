@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Cached responses skip the handler and so its simulated latency
+func TestCacheHitSkipsAPILatency(t *testing.T) {
+	setVar(t, &cachePaths, []string{"/api"})
+	setVar(t, &responseCache, newLRUCache(10, time.Minute))
+	setAtomic(t, &apiLatency, int64(100*time.Millisecond))
+	rt := newTestRouter(t)
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		cache    string
+		min, max time.Duration
+	}{
+		{"miss runs the handler", http.MethodGet, "/api", "MISS", 100 * time.Millisecond, time.Second},
+		{"hit skips the latency", http.MethodGet, "/api", "HIT", 0, 50 * time.Millisecond},
+		{"other query misses", http.MethodGet, "/api?ops=1", "MISS", 100 * time.Millisecond, time.Second},
+		{"post is not cached", http.MethodPost, "/api", "", 100 * time.Millisecond, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			rec := serve(rt, tt.method, tt.target)
+			elapsed := time.Since(start)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			if got := rec.Header().Get("X-Cache"); got != tt.cache {
+				t.Errorf("X-Cache %q, want %q", got, tt.cache)
+			}
+			if elapsed < tt.min || elapsed > tt.max {
+				t.Errorf("took %s, want between %s and %s", elapsed, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+// Only 200s are stored
+func TestCacheSkipsErrors(t *testing.T) {
+	setVar(t, &cachePaths, []string{"/api"})
+	setVar(t, &responseCache, newLRUCache(10, time.Minute))
+	rt := newTestRouter(t)
+
+	for range 2 {
+		rec := serve(rt, http.MethodGet, "/api?ops=0")
+		if rec.Code != http.StatusBadRequest || rec.Header().Get("X-Cache") != "MISS" {
+			t.Errorf("invalid request: status %d, X-Cache %q", rec.Code, rec.Header().Get("X-Cache"))
+		}
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	now := time.Now()
+	c := newLRUCache(2, time.Second)
+	put := func(key string) {
+		c.put(&cachedResponse{key: key, expires: now.Add(c.ttl)})
+	}
+
+	put("a")
+	put("b")
+	c.get("a", now) // a is now the most recently used
+	put("c")        // evicts b
+
+	tests := []struct {
+		key  string
+		at   time.Time
+		want bool
+	}{
+		{"a", now, true},
+		{"b", now, false},
+		{"c", now, true},
+		{"c", now.Add(2 * time.Second), false},
+	}
+	for _, tt := range tests {
+		if _, ok := c.get(tt.key, tt.at); ok != tt.want {
+			t.Errorf("get(%q) at +%s = %v, want %v", tt.key, tt.at.Sub(now), ok, tt.want)
+		}
+	}
+}
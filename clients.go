@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Gauge for distinct client IPs seen over the rolling window
+	distinctClientsGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "distinct_clients",
+			Help: "Approximate number of distinct client IPs seen over the rolling window",
+		},
+	)
+
+	distinctClients = newClientSet(10000)
+
+	// Rolling window for distinct_clients
+	distinctClientsWindow = 5 * time.Minute
+)
+
+// Client IP of the request: the first X-Forwarded-For entry, then X-Real-IP,
+// then the connection's remote address
+func clientIP(r *http.Request) string {
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		first, _, _ := strings.Cut(xff, ",")
+		if ip := strings.TrimSpace(first); ip != "" {
+			return ip
+		}
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Set of client IPs over a rolling window, kept as two generations that each
+// cover half the window. Each generation holds at most max entries, so memory
+// stays bounded; past that the count saturates and is a lower bound.
+type clientSet struct {
+	max int
+
+	mu       sync.Mutex
+	current  map[string]struct{}
+	previous map[string]struct{}
+	// Entries of current that are not in previous
+	added int
+}
+
+func newClientSet(max int) *clientSet {
+	return &clientSet{max: max, current: map[string]struct{}{}, previous: map[string]struct{}{}}
+}
+
+func (s *clientSet) add(ip string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.current[ip]; ok || len(s.current) >= s.max {
+		return
+	}
+	s.current[ip] = struct{}{}
+	if _, ok := s.previous[ip]; !ok {
+		s.added++
+	}
+	distinctClientsGauge.Set(float64(len(s.previous) + s.added))
+}
+
+// Start a new generation, dropping clients not seen for a full window
+func (s *clientSet) rotate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.previous = s.current
+	s.current = make(map[string]struct{}, len(s.previous))
+	s.added = 0
+	distinctClientsGauge.Set(float64(len(s.previous)))
+}
+
+// Rotate the distinct client set every half window
+func rotateDistinctClients(ctx context.Context, window time.Duration) {
+	ticker := time.NewTicker(window / 2)
+	defer ticker.Stop()
+	hb := newHeartbeat("distinct_clients", window/2)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			hb.beat()
+			distinctClients.rotate()
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name        string
+		xff, realIP string
+		remoteAddr  string
+		ip          string
+	}{
+		{"remote address", "", "", "192.0.2.1:1234", "192.0.2.1"},
+		{"ipv6 remote address", "", "", "[2001:db8::1]:1234", "2001:db8::1"},
+		{"no port", "", "", "192.0.2.1", "192.0.2.1"},
+		{"forwarded", "203.0.113.7, 10.0.0.1", "198.51.100.2", "192.0.2.1:1234", "203.0.113.7"},
+		{"empty forwarded entry", " ,10.0.0.1", "198.51.100.2", "192.0.2.1:1234", "198.51.100.2"},
+		{"real ip", "", " 198.51.100.2 ", "192.0.2.1:1234", "198.51.100.2"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if tt.xff != "" {
+			r.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if got := clientIP(r); got != tt.ip {
+			t.Errorf("%s: client IP %q, want %q", tt.name, got, tt.ip)
+		}
+	}
+}
+
+// The set counts each client once per window, forgets clients after two
+// rotations and stops growing at its bound
+func TestClientSet(t *testing.T) {
+	s := newClientSet(5)
+	tests := []struct {
+		name   string
+		add    []string
+		rotate bool // before adding
+		count  float64
+	}{
+		{"new clients", []string{"a", "b", "c"}, false, 3},
+		{"repeats", []string{"a", "a", "b"}, false, 3},
+		{"half window later", nil, true, 3},
+		{"returning client", []string{"a"}, false, 3},
+		{"new client", []string{"d"}, false, 4},
+		// b and c were last seen two generations ago
+		{"full window later", nil, true, 2},
+		// Each generation stops at 5: a and d from the previous one plus 5 new
+		{"bounded", []string{"e", "f", "g", "h", "i", "j"}, false, 7},
+	}
+	for _, tt := range tests {
+		if tt.rotate {
+			s.rotate()
+		}
+		for _, ip := range tt.add {
+			s.add(ip)
+		}
+		if got := metricValue(t, distinctClientsGauge); got != tt.count {
+			t.Errorf("%s: distinct_clients %g, want %g", tt.name, got, tt.count)
+		}
+	}
+}
+
+// Requests from several clients through the middleware are each counted once
+func TestDistinctClientsFromRequests(t *testing.T) {
+	setVar(t, &distinctClients, newClientSet(10000))
+	h := metricsMiddleware(func(w http.ResponseWriter, r *http.Request) {})
+	for i := 0; i < 300; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/clients", nil)
+		r.RemoteAddr = fmt.Sprintf("10.0.%d.%d:4000", i%50/10, i%10)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if got := metricValue(t, distinctClientsGauge); got != 50 {
+		t.Errorf("distinct_clients %g after 50 clients, want 50", got)
+	}
+}
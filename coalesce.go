@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	// Counter for /api requests answered by another request's execution
+	coalescedRequestsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "coalesced_requests_total",
+			Help: "Total number of /api requests that shared an identical in-flight request's response",
+		},
+	)
+
+	// Share one execution between identical concurrent /api GETs, from API_COALESCE
+	apiCoalesce bool
+	apiGroup    singleflight.Group
+)
+
+// Response captured in memory so it can be replayed to every waiter
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	if b.status == 0 {
+		b.status = code
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+// Copy the captured response to w
+func (b *bufferedResponse) replay(w http.ResponseWriter) {
+	for k, v := range b.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(max(b.status, http.StatusOK))
+	w.Write(b.body.Bytes())
+}
+
+// Coalesce identical concurrent GETs (same query) into one call of next,
+// replaying its response to all of them. Streaming requests are not
+// coalesced. The leader's context governs the shared execution, so a
+// leader that goes away cancels the simulated work for everyone.
+func coalesced(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !apiCoalesce || r.Method != http.MethodGet || r.URL.Query().Has("stream_bytes") {
+			next(w, r)
+			return
+		}
+
+		executed := false
+		v, _, _ := apiGroup.Do(r.URL.RawQuery, func() (any, error) {
+			executed = true
+			resp := &bufferedResponse{header: http.Header{}}
+			next(resp, r)
+			return resp, nil
+		})
+		if !executed {
+			coalescedRequestsTotal.Inc()
+		}
+		v.(*bufferedResponse).replay(w)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+)
+
+// Cohorts accepted in ?cohort=, from COHORTS. The allowlist bounds the
+// cardinality of the cohort label; anything else is counted as "other".
+var cohorts []string
+
+// Cohort label for a request: "default" when untagged, the tag if allowed,
+// "other" otherwise
+func requestCohort(r *http.Request) string {
+	cohort := r.URL.Query().Get("cohort")
+	switch {
+	case cohort == "":
+		return "default"
+	case slices.Contains(cohorts, cohort):
+		return cohort
+	}
+	return "other"
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// Tagged requests are counted under their cohort when allowed, and under
+// "default" or "other" otherwise
+func TestCohortCounts(t *testing.T) {
+	setVar(t, &cohorts, []string{"canary", "baseline"})
+	h := metricsMiddleware(func(w http.ResponseWriter, r *http.Request) {})
+
+	requests := []string{
+		"/cohort",
+		"/cohort?cohort=",
+		"/cohort?cohort=canary",
+		"/cohort?cohort=canary&ops=2",
+		"/cohort?cohort=canary",
+		"/cohort?cohort=baseline",
+		"/cohort?cohort=Canary",
+		"/cohort?cohort=user-1234",
+	}
+	tests := []struct {
+		cohort string
+		count  float64
+	}{
+		{"default", 2},
+		{"canary", 3},
+		{"baseline", 1},
+		{"other", 2},
+		{"Canary", 0},
+		{"user-1234", 0},
+	}
+	before := make([]float64, len(tests))
+	for i, tt := range tests {
+		before[i] = metricValue(t, httpRequestsTotal.WithLabelValues("/cohort", http.MethodGet, "200", tt.cohort))
+	}
+	for _, target := range requests {
+		serve(h, http.MethodGet, target)
+	}
+	for i, tt := range tests {
+		if got := metricValue(t, httpRequestsTotal.WithLabelValues("/cohort", http.MethodGet, "200", tt.cohort)) - before[i]; got != tt.count {
+			t.Errorf("cohort %q counted %g requests, want %g", tt.cohort, got, tt.count)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// Extra latency of the first /api request, from COLD_START_PENALTY; 0 disables
+	coldStartPenalty time.Duration
+
+	// Requests over which the penalty halves, from COLD_START_HALF_LIFE
+	coldStartHalfLife = 10
+
+	// /api requests seen so far, driving the decay
+	coldStartServed atomic.Int64
+)
+
+// Extra latency for the next /api request, modelling JIT and cache warm-up:
+// the penalty halves every coldStartHalfLife requests until it is negligible
+func coldStartLatency() time.Duration {
+	if coldStartPenalty <= 0 {
+		return 0
+	}
+	n := coldStartServed.Add(1) - 1
+	extra := time.Duration(float64(coldStartPenalty) * math.Exp2(-float64(n)/float64(coldStartHalfLife)))
+	if extra < time.Microsecond {
+		return 0
+	}
+	return extra
+}
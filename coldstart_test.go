@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// The penalty halves every half-life of requests down to nothing
+func TestColdStartLatency(t *testing.T) {
+	setVar(t, &coldStartPenalty, 400*time.Millisecond)
+	setVar(t, &coldStartHalfLife, 2)
+	setAtomic(t, &coldStartServed, 0)
+
+	tests := []struct {
+		request int
+		extra   time.Duration
+	}{
+		{1, 400 * time.Millisecond},
+		{3, 200 * time.Millisecond},
+		{5, 100 * time.Millisecond},
+		{7, 50 * time.Millisecond},
+		{41, 0}, // below a microsecond
+	}
+	n := 0
+	for _, tt := range tests {
+		var extra time.Duration
+		for n < tt.request {
+			extra = coldStartLatency()
+			n++
+		}
+		if d := extra - tt.extra; d < -time.Microsecond || d > time.Microsecond {
+			t.Errorf("request %d: extra %s, want %s", tt.request, extra, tt.extra)
+		}
+	}
+
+	setVar(t, &coldStartPenalty, 0)
+	if extra := coldStartLatency(); extra != 0 {
+		t.Errorf("disabled: extra %s", extra)
+	}
+}
+
+// Early /api requests are slower, later ones reach the base latency
+func TestColdStartRequests(t *testing.T) {
+	resetLatencyOverrides(t)
+	setVar(t, &coldStartPenalty, 100*time.Millisecond)
+	setVar(t, &coldStartHalfLife, 1)
+	setAtomic(t, &coldStartServed, 0)
+	setAtomic(t, &apiLatency, int64(10*time.Millisecond))
+	setAtomic(t, &spikeUntil, 0)
+	setVar(t, &latencyPerQPS, 0)
+	setVar(t, &latencyDist, latencyDistConfig{kind: latencyFixed})
+
+	tests := []struct {
+		min, max time.Duration
+	}{
+		{110 * time.Millisecond, 150 * time.Millisecond},
+		{60 * time.Millisecond, 100 * time.Millisecond},
+		{35 * time.Millisecond, 75 * time.Millisecond},
+	}
+	for i, tt := range tests {
+		start := time.Now()
+		serve(http.HandlerFunc(apiHandler), http.MethodGet, "/api")
+		if elapsed := time.Since(start); elapsed < tt.min || elapsed > tt.max {
+			t.Errorf("request %d took %s, want between %s and %s", i+1, elapsed, tt.min, tt.max)
+		}
+	}
+	// Warm: 20 halvings leave well under a microsecond
+	for range 20 {
+		coldStartLatency()
+	}
+	start := time.Now()
+	serve(http.HandlerFunc(apiHandler), http.MethodGet, "/api")
+	if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+		t.Errorf("warm request took %s, want about the 10ms base", elapsed)
+	}
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// Probe paths; the health handler is also served at /healthz
+	healthPath = "/health"
+	readyPath  = "/ready"
+
+	// Successful non-probe requests required before reporting ready
+	readyMinRequests uint64
+
+	// Largest request header block the server reads, from MAX_HEADER_BYTES
+	maxHeaderBytes = http.DefaultMaxHeaderBytes
+
+	// Worker pool for /api; a size of 0 handles requests inline
+	workerPoolSize  int
+	workerPoolQueue = 100
+
+	// Overall shutdown timeout and the part of it spent draining connections
+	shutdownTimeout = 10 * time.Second
+	drainTimeout    = 8 * time.Second
+
+	// Time between failing readiness and draining on SIGTERM, from
+	// SHUTDOWN_GRACE_DELAY; SIGINT skips it
+	shutdownGraceDelay = 5 * time.Second
+
+	// Exit fatally when draining times out instead of force-closing connections
+	shutdownFatalOnTimeout bool
+
+	// TLS key pair; TLS is enabled when the certificate file is set
+	tlsCertFile, tlsKeyFile string
+	tlsReloadInterval       = 30 * time.Second
+
+	// Serve OpenMetrics on /metrics so exemplars are exposed
+	openMetricsEnabled bool
+
+	// Rolling error ratio settings
+	errorRatio = defaultErrorRatioConfig
+
+	// Circuit breaker around the simulated downstream
+	downstreamBreaker = newCircuitBreaker(breakerConfig{enabled: false})
+
+	// Self-generated load, disabled by default
+	selfLoad = selfLoadConfig{path: "/api", concurrency: 4}
+)
+
+// Load feature settings from the environment; invalid values are fatal
+func loadSettings() {
+	// Optional CPU pinning for burn workers (Linux only)
+	if v := os.Getenv("BURN_PIN_CPUS"); v != "" {
+		cpus, err := parseCPUList(v)
+		if err != nil {
+			log.Fatalf("Invalid BURN_PIN_CPUS: %v", err)
+		}
+		burnPinCPUs = cpus
+		log.Printf("Burn workers pinned to CPUs %v", burnPinCPUs)
+	}
+
+	// Coalesce concurrent identical /burn requests into one burn
+	burnCoalesce = envBool("BURN_COALESCE", burnCoalesce)
+
+	// Bulkhead size for /burn, defaults to one burn per CPU
+	burnMax := envInt("BURN_MAX_CONCURRENT", cap(burnSlots))
+	if burnMax < 1 {
+		log.Fatalf("Invalid BURN_MAX_CONCURRENT %d: must be positive", burnMax)
+	}
+	burnSlots = make(chan struct{}, burnMax)
+
+	// Rolling error ratio window and alert threshold
+	errorRatio.window = envDuration("ERROR_RATIO_WINDOW", errorRatio.window)
+	errorRatio.threshold = envFloat("ERROR_RATIO_THRESHOLD", errorRatio.threshold)
+	errorRatio.minRequests = uint64(envInt("ERROR_RATIO_MIN_REQUESTS", int(errorRatio.minRequests)))
+	if errorRatio.window < time.Second {
+		log.Fatalf("Invalid ERROR_RATIO_WINDOW %s: must be at least 1s", errorRatio.window)
+	}
+
+	// Per-path latency SLOs and their burn-rate windows
+	slos, err := parseLatencySLOs(os.Getenv("LATENCY_SLOS"))
+	if err != nil {
+		log.Fatalf("Invalid LATENCY_SLOS: %v", err)
+	}
+	latencySLOs = slos
+
+	// Simulated downstream fan-out for /api
+	downstream.calls = envInt("API_DOWNSTREAM_CALLS", downstream.calls)
+	downstream.parallel = envBool("API_DOWNSTREAM_PARALLEL", downstream.parallel)
+	downstream.latency = envDuration("API_DOWNSTREAM_LATENCY", downstream.latency)
+	downstream.errorRate = envFloat("API_DOWNSTREAM_ERROR_RATE", downstream.errorRate)
+
+	// Named simulated dependencies for /call
+	deps, err := parseDependencies(os.Getenv("DEPENDENCIES"))
+	if err != nil {
+		log.Fatalf("Invalid DEPENDENCIES: %v", err)
+	}
+	dependencies = deps
+
+	// Circuit breaker thresholds for the simulated downstream
+	downstreamBreaker = newCircuitBreaker(breakerConfig{
+		enabled:        envBool("BREAKER_ENABLED", true),
+		window:         envInt("BREAKER_WINDOW", 20),
+		minRequests:    envInt("BREAKER_MIN_REQUESTS", 10),
+		errorThreshold: envFloat("BREAKER_ERROR_THRESHOLD", 0.5),
+		openDuration:   envDuration("BREAKER_OPEN_DURATION", 5*time.Second),
+	})
+
+	// Self-generated load against our own server
+	selfLoad.qps = envFloat("SELF_LOAD_QPS", selfLoad.qps)
+	selfLoad.path = envString("SELF_LOAD_PATH", selfLoad.path)
+	selfLoad.concurrency = envInt("SELF_LOAD_CONCURRENCY", selfLoad.concurrency)
+	if math.IsNaN(selfLoad.qps) || selfLoad.qps < 0 || selfLoad.qps > maxSelfLoadQPS || selfLoad.concurrency < 1 {
+		log.Fatalf("Invalid self-load settings: SELF_LOAD_QPS must be between 0 and %g and SELF_LOAD_CONCURRENCY >= 1", maxSelfLoadQPS)
+	}
+	if !strings.HasPrefix(selfLoad.path, "/") {
+		log.Fatalf("Invalid SELF_LOAD_PATH %q: must start with /", selfLoad.path)
+	}
+
+	// Initial simulated /api latency; adjustable at runtime via /admin/latency
+	if v := os.Getenv("API_LATENCY"); v != "" {
+		d, err := parseLatency(v)
+		if err != nil {
+			log.Fatalf("Invalid API_LATENCY: %v", err)
+		}
+		apiLatency.Store(int64(d))
+	}
+
+	// Resident memory baseline allocated at startup
+	baselineMemoryMB = envInt("BASELINE_MEMORY_MB", baselineMemoryMB)
+	if baselineMemoryMB < 0 {
+		log.Fatalf("Invalid BASELINE_MEMORY_MB %d: must be >= 0", baselineMemoryMB)
+	}
+
+	// Adaptive concurrency limit for /api
+	limits := defaultLimiterConfig
+	limits.initial = envInt("ADAPTIVE_LIMIT_INITIAL", limits.initial)
+	limits.min = envInt("ADAPTIVE_LIMIT_MIN", limits.min)
+	limits.max = envInt("ADAPTIVE_LIMIT_MAX", limits.max)
+	limits.latencyThreshold = envDuration("ADAPTIVE_LIMIT_LATENCY", limits.latencyThreshold)
+	limits.backoff = envFloat("ADAPTIVE_LIMIT_BACKOFF", limits.backoff)
+	limits.window = envInt("ADAPTIVE_LIMIT_WINDOW", limits.window)
+	limiter, err := newConcurrencyLimiter(os.Getenv("ADAPTIVE_LIMIT"), limits)
+	if err != nil {
+		log.Fatalf("Invalid adaptive limit settings: %v", err)
+	}
+	apiLimiter = limiter
+
+	// Coalesce identical concurrent /api GETs into one execution
+	apiCoalesce = envBool("API_COALESCE", apiCoalesce)
+
+	// QPS averaging window; adjustable at runtime via /admin/qps-window
+	if v := os.Getenv("QPS_WINDOW"); v != "" {
+		n, err := parseQPSWindow(v)
+		if err != nil {
+			log.Fatalf("Invalid QPS_WINDOW: %v", err)
+		}
+		qpsWindow.Store(int64(n))
+	}
+
+	// Cold-start penalty on the first /api requests, decaying to steady state
+	coldStartPenalty = envDuration("COLD_START_PENALTY", coldStartPenalty)
+	coldStartHalfLife = envInt("COLD_START_HALF_LIFE", coldStartHalfLife)
+	if coldStartPenalty < 0 || coldStartPenalty > maxAPILatency || coldStartHalfLife < 1 {
+		log.Fatalf("Invalid cold start settings: COLD_START_PENALTY must be in [0, %s] and COLD_START_HALF_LIFE >= 1", maxAPILatency)
+	}
+
+	// QPS-driven contention: /api latency grows by LATENCY_PER_QPS per request per second
+	latencyPerQPS = envDuration("LATENCY_PER_QPS", latencyPerQPS)
+	contentionMaxLatency = envDuration("LATENCY_CONTENTION_MAX", contentionMaxLatency)
+	if latencyPerQPS < 0 || contentionMaxLatency < 0 || contentionMaxLatency > maxAPILatency {
+		log.Fatalf("Invalid contention settings: LATENCY_PER_QPS must be >= 0 and LATENCY_CONTENTION_MAX in [0, %s]", maxAPILatency)
+	}
+
+	// Server-Timing response header and trailer
+	serverTimingEnabled = envBool("SERVER_TIMING", serverTimingEnabled)
+
+	// Per-request access log, off unless ACCESS_LOG_FORMAT is json or combined
+	accessLogFormat = envString("ACCESS_LOG_FORMAT", accessLogFormat)
+	if err := validAccessLogFormat(accessLogFormat); err != nil {
+		log.Fatalf("Invalid ACCESS_LOG_FORMAT: %v", err)
+	}
+
+	// Response cache for GETs on CACHE_PATHS
+	cachePaths = parseList(os.Getenv("CACHE_PATHS"))
+	cacheSize := envInt("CACHE_SIZE", responseCache.size)
+	cacheTTL := envDuration("CACHE_TTL", responseCache.ttl)
+	if cacheSize < 1 || cacheTTL <= 0 {
+		log.Fatalf("Invalid cache settings: CACHE_SIZE and CACHE_TTL must be positive")
+	}
+	responseCache = newLRUCache(cacheSize, cacheTTL)
+
+	// Per-request CPU ratio, Linux only
+	cpuRatioEnabled = envBool("CPU_RATIO", cpuRatioEnabled)
+
+	// Fraction of requests sampled for handler_goroutine_delta
+	goroutineDeltaSample = envFloat("GOROUTINE_DELTA_SAMPLE", goroutineDeltaSample)
+	if goroutineDeltaSample < 0 || goroutineDeltaSample > 1 {
+		log.Fatalf("Invalid GOROUTINE_DELTA_SAMPLE %g: must be in [0,1]", goroutineDeltaSample)
+	}
+
+	// Watchdog over the background loops' heartbeats
+	watchdogInterval = envDuration("WATCHDOG_INTERVAL", watchdogInterval)
+	watchdogThreshold = envDuration("WATCHDOG_THRESHOLD", watchdogThreshold)
+	if watchdogInterval <= 0 || watchdogThreshold <= 0 {
+		log.Fatalf("Invalid watchdog settings: WATCHDOG_INTERVAL and WATCHDOG_THRESHOLD must be positive")
+	}
+
+	// Bounded worker pool for /api
+	workerPoolSize = envInt("WORKER_POOL_SIZE", workerPoolSize)
+	workerPoolQueue = envInt("WORKER_POOL_QUEUE", workerPoolQueue)
+	if workerPoolSize < 0 || workerPoolQueue < 0 {
+		log.Fatalf("Invalid worker pool settings: WORKER_POOL_SIZE and WORKER_POOL_QUEUE must be >= 0")
+	}
+
+	// Request header limit; net/http adds 4KB of slack on top of it
+	maxHeaderBytes = envInt("MAX_HEADER_BYTES", maxHeaderBytes)
+	if maxHeaderBytes < 1 {
+		log.Fatalf("Invalid MAX_HEADER_BYTES %d: must be positive", maxHeaderBytes)
+	}
+	log.Printf("Max header bytes: %d", maxHeaderBytes)
+
+	// Request body limit for upload routes
+	maxBodyBytes = int64(envInt("MAX_BODY_BYTES", int(maxBodyBytes)))
+	if maxBodyBytes < 0 {
+		log.Fatalf("Invalid MAX_BODY_BYTES %d: must be >= 0", maxBodyBytes)
+	}
+
+	// Retry-After sent with draining and load-shedding 503s
+	retryAfterSeconds = envInt("RETRY_AFTER_SECONDS", retryAfterSeconds)
+	if retryAfterSeconds < 0 {
+		log.Fatalf("Invalid RETRY_AFTER_SECONDS %d: must be >= 0", retryAfterSeconds)
+	}
+
+	// Custom body for load-shedding responses
+	shedResponseBody = os.Getenv("SHED_RESPONSE_BODY")
+	shedResponseContentType = envString("SHED_RESPONSE_CONTENT_TYPE", shedResponseContentType)
+
+	// Hosts /proxy may call; empty rejects every target
+	proxyAllowlist = parseAllowlist(os.Getenv("PROXY_ALLOWLIST"))
+
+	// Shutdown timeouts; connections still open when draining times out are force-closed
+	shutdownTimeout = envDuration("SHUTDOWN_TIMEOUT", shutdownTimeout)
+	drainTimeout = envDuration("DRAIN_TIMEOUT", min(drainTimeout, shutdownTimeout))
+	if shutdownTimeout <= 0 || drainTimeout <= 0 || drainTimeout > shutdownTimeout {
+		log.Fatalf("Invalid shutdown timeouts: need 0 < DRAIN_TIMEOUT <= SHUTDOWN_TIMEOUT")
+	}
+	shutdownFatalOnTimeout = envBool("SHUTDOWN_FATAL_ON_TIMEOUT", shutdownFatalOnTimeout)
+	shutdownGraceDelay = envDuration("SHUTDOWN_GRACE_DELAY", shutdownGraceDelay)
+	if shutdownGraceDelay < 0 {
+		log.Fatalf("Invalid SHUTDOWN_GRACE_DELAY %s: must be >= 0", shutdownGraceDelay)
+	}
+
+	// Listener address family
+	listenNetwork = envString("LISTEN_NETWORK", listenNetwork)
+	if err := validListenNetwork(listenNetwork); err != nil {
+		log.Fatalf("Invalid LISTEN_NETWORK: %v", err)
+	}
+
+	// Per-connection idle deadline enforced by the listener
+	connIdleTimeout = envDuration("CONN_IDLE_TIMEOUT", connIdleTimeout)
+	if connIdleTimeout < 0 {
+		log.Fatalf("Invalid CONN_IDLE_TIMEOUT %s: must be >= 0", connIdleTimeout)
+	}
+
+	// Proactive close of idle keep-alive connections, shorter than IdleTimeout
+	idleClose = envDuration("IDLE_CLOSE", idleClose)
+	if idleClose < 0 {
+		log.Fatalf("Invalid IDLE_CLOSE %s: must be >= 0", idleClose)
+	}
+
+	// TLS certificate files and how often they are checked for changes
+	tlsCertFile = os.Getenv("TLS_CERT_FILE")
+	tlsKeyFile = os.Getenv("TLS_KEY_FILE")
+	if (tlsCertFile == "") != (tlsKeyFile == "") {
+		log.Fatalf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	tlsReloadInterval = envDuration("TLS_RELOAD_INTERVAL", tlsReloadInterval)
+	if tlsReloadInterval <= 0 {
+		log.Fatalf("Invalid TLS_RELOAD_INTERVAL %s: must be positive", tlsReloadInterval)
+	}
+
+	// HTTP/3 on a UDP port, sharing the TLS certificate
+	http3Port = os.Getenv("HTTP3_PORT")
+	if http3Port != "" && tlsCertFile == "" {
+		log.Fatalf("HTTP3_PORT requires TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+
+	// Latency distribution and its parameters, drawn from a seeded PRNG
+	latencyDist.kind = envString("LATENCY_DIST", latencyDist.kind)
+	if err := validLatencyDist(latencyDist.kind); err != nil {
+		log.Fatalf("Invalid LATENCY_DIST: %v", err)
+	}
+	mean := time.Duration(apiLatency.Load())
+	latencyDist.spread = envDuration("LATENCY_SPREAD", mean/2)
+	latencyDist.stddev = envDuration("LATENCY_STDDEV", mean/4)
+	if latencyDist.spread < 0 || latencyDist.stddev < 0 {
+		log.Fatalf("Invalid latency distribution: LATENCY_SPREAD and LATENCY_STDDEV must be >= 0")
+	}
+	if os.Getenv("LATENCY_SEED") != "" {
+		seedLatencyRand(uint64(envInt("LATENCY_SEED", 0)))
+	}
+
+	// Token for /admin endpoints; /admin/panic is disabled without one
+	adminToken = envOrFile("ADMIN_TOKEN")
+
+	// Optional /metrics protection and scrape logging
+	if token := envOrFile("METRICS_AUTH_TOKEN"); token != "" {
+		metricsAuth = tokenCredentials(token)
+	}
+	metricsAccessLog = envBool("METRICS_ACCESS_LOG", metricsAccessLog)
+	metricsDisableCompression = envBool("METRICS_DISABLE_COMPRESSION", metricsDisableCompression)
+
+	// Distinct client tracking window and per-generation bound
+	distinctClientsWindow = envDuration("DISTINCT_CLIENTS_WINDOW", distinctClientsWindow)
+	if distinctClientsWindow < 2*time.Second {
+		log.Fatalf("Invalid DISTINCT_CLIENTS_WINDOW %s: must be at least 2s", distinctClientsWindow)
+	}
+	clientsMax := envInt("DISTINCT_CLIENTS_MAX", distinctClients.max)
+	if clientsMax < 1 {
+		log.Fatalf("Invalid DISTINCT_CLIENTS_MAX %d: must be positive", clientsMax)
+	}
+	distinctClients = newClientSet(clientsMax)
+
+	// Per-client-IP token bucket; the burst defaults to one second's worth
+	if rate := envFloat("IP_RATE_LIMIT", 0); rate > 0 {
+		burst := envInt("IP_RATE_BURST", max(1, int(math.Ceil(rate))))
+		if burst < 1 {
+			log.Fatalf("Invalid IP_RATE_BURST %d: must be positive", burst)
+		}
+		ipLimiter = newClientRateLimiter(rate, burst)
+		log.Printf("Per-client rate limit: %g requests/s, burst %d", rate, burst)
+	} else if rate < 0 {
+		log.Fatalf("Invalid IP_RATE_LIMIT %g: must be >= 0", rate)
+	}
+
+	// Exemplars are only exposed in the OpenMetrics format
+	openMetricsEnabled = envBool("OPENMETRICS", openMetricsEnabled)
+
+	// Probe paths; the health handler is also served at /healthz for compatibility
+	healthPath = envString("HEALTH_PATH", healthPath)
+	readyPath = envString("READY_PATH", readyPath)
+
+	// Dependencies /ready probes, with the probe timeout and result cache lifetime
+	if urls := parseList(os.Getenv("READINESS_DEPS")); len(urls) > 0 {
+		checker, err := newDepChecker(urls,
+			envDuration("READINESS_DEPS_TIMEOUT", time.Second),
+			envDuration("READINESS_DEPS_CACHE", 5*time.Second))
+		if err != nil {
+			log.Fatalf("Invalid READINESS_DEPS: %v", err)
+		}
+		readinessDeps = checker
+	}
+
+	// Fraction of app requests aborted with a connection reset
+	abortRate = envFloat("ABORT_RATE", abortRate)
+	if abortRate < 0 || abortRate > 1 {
+		log.Fatalf("Invalid ABORT_RATE %g: must be in [0,1]", abortRate)
+	}
+
+	// Replica recommendation from QPS, mirroring the HPA formula
+	scalingTargetQPS = envFloat("SCALING_TARGET_QPS", scalingTargetQPS)
+	currentReplicas = envInt("CURRENT_REPLICAS", currentReplicas)
+	if scalingTargetQPS < 0 || currentReplicas < 1 {
+		log.Fatalf("Invalid scaling recommendation settings: need SCALING_TARGET_QPS >= 0 and CURRENT_REPLICAS >= 1")
+	}
+
+	// Size of the /admin/events ring buffer
+	eventLogSize := envInt("EVENT_LOG_SIZE", len(events.entries))
+	if eventLogSize < 1 {
+		log.Fatalf("Invalid EVENT_LOG_SIZE %d: must be positive", eventLogSize)
+	}
+	events = newEventLog(eventLogSize)
+
+	// Background garbage generation
+	gcPressureMBPerSec = envFloat("GC_PRESSURE_MB_PER_SEC", gcPressureMBPerSec)
+	if gcPressureMBPerSec < 0 {
+		log.Fatalf("Invalid GC_PRESSURE_MB_PER_SEC %g: must be >= 0", gcPressureMBPerSec)
+	}
+
+	// Simulated database pool behind /db
+	dbPoolSize := envInt("DB_POOL_SIZE", cap(dbPool.conns))
+	dbQueryLatency := envDuration("DB_QUERY_LATENCY", dbPool.queryLatency)
+	dbAcquireTimeout := envDuration("DB_ACQUIRE_TIMEOUT", dbPool.acquireTimeout)
+	if dbPoolSize < 1 || dbQueryLatency < 0 || dbAcquireTimeout <= 0 {
+		log.Fatalf("Invalid /db pool settings: need DB_POOL_SIZE >= 1, DB_QUERY_LATENCY >= 0 and DB_ACQUIRE_TIMEOUT > 0")
+	}
+	dbPool = newConnPool(dbPoolSize, dbQueryLatency, dbAcquireTimeout)
+
+	// Allowed ?cohort= tags for the cohort label on http_requests_total
+	cohorts = parseList(os.Getenv("COHORTS"))
+	for _, c := range cohorts {
+		if c == "default" || c == "other" {
+			log.Fatalf("Invalid COHORTS: %q is reserved", c)
+		}
+	}
+
+	// Deliberate crash at startup, to simulate a crash loop
+	crashOnStartProbability = envFloat("CRASH_ON_START_PROBABILITY", crashOnStartProbability)
+	if crashOnStartProbability < 0 || crashOnStartProbability > 1 {
+		log.Fatalf("Invalid CRASH_ON_START_PROBABILITY %g: must be in [0,1]", crashOnStartProbability)
+	}
+
+	// Deliberate crash after a number of requests
+	crashAfter := envInt("CRASH_AFTER_REQUESTS", 0)
+	if crashAfter < 0 {
+		log.Fatalf("Invalid CRASH_AFTER_REQUESTS %d: must be >= 0", crashAfter)
+	}
+	crashAfterRequests = uint64(crashAfter)
+	crashMode = envString("CRASH_MODE", crashMode)
+	if crashMode != "shutdown" && crashMode != "panic" {
+		log.Fatalf("Invalid CRASH_MODE %q: want shutdown or panic", crashMode)
+	}
+	if crashAfterRequests > 0 {
+		log.Printf("Will %s after %d requests (CRASH_AFTER_REQUESTS)", crashMode, crashAfterRequests)
+	}
+
+	// Warmup gate: stay unready until this many requests were served successfully
+	minRequests := envInt("READY_MIN_REQUESTS", 0)
+	if minRequests < 0 {
+		log.Fatalf("Invalid READY_MIN_REQUESTS %d: must be >= 0", minRequests)
+	}
+	readyMinRequests = uint64(minRequests)
+}
+
+// Read a setting from the environment, or from the file named by NAME_FILE
+// when the variable itself is unset, as with Kubernetes secrets mounted as
+// files. The file contents are trimmed; an unreadable file is fatal.
+func envOrFile(name string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to read %s_FILE: %v", name, err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Read a string setting from the environment, falling back to def when unset
+func envString(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// Read an integer setting from the environment; invalid values are fatal
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", name, v, err)
+	}
+	return n
+}
+
+// Read a float setting from the environment; invalid values are fatal
+func envFloat(name string, def float64) float64 {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", name, v, err)
+	}
+	return f
+}
+
+// Read a boolean setting from the environment; invalid values are fatal
+func envBool(name string, def bool) bool {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", name, v, err)
+	}
+	return b
+}
+
+// Read a duration setting such as "250ms" from the environment; invalid values are fatal
+func envDuration(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", name, v, err)
+	}
+	return d
+}
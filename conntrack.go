@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Histogram for the wait between accepting a connection and its first request's handler
+	acceptToHandler = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "accept_to_handler_seconds",
+			Help:    "Time from accepting a connection to the handler starting its first request",
+			Buckets: []float64{.0001, .0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		},
+	)
+
+	// Counter for keep-alive connections closed by IDLE_CLOSE
+	connIdleClosedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "conn_idle_closed_total",
+			Help: "Total number of idle keep-alive connections closed proactively after IDLE_CLOSE",
+		},
+	)
+
+	// Close keep-alive connections idle this long, from IDLE_CLOSE; 0 leaves
+	// it to the server's IdleTimeout
+	idleClose time.Duration
+)
+
+// Counts open connections through the server's ConnState hook and remembers
+// when each was accepted until its first request starts
+type connTracker struct {
+	open atomic.Int64
+
+	// Accept time by net.Conn. Keyed by the connection rather than its
+	// RemoteAddr because PROXY protocol connections only learn their remote
+	// address by reading the header, which must not block the accept loop.
+	accepted sync.Map
+
+	// Pending idle-close timer by net.Conn
+	idleTimers sync.Map
+}
+
+// Timer closing a connection that stays idle; cancelled when it becomes active
+type idleTimer struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	stopped bool
+}
+
+var conns connTracker
+
+// http.Server.ConnState callback
+func (t *connTracker) track(c net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		t.open.Add(1)
+		t.accepted.Store(c, time.Now())
+	case http.StateIdle:
+		if idleClose > 0 {
+			t.closeWhenIdle(c)
+		}
+	case http.StateActive:
+		t.cancelIdleClose(c)
+	case http.StateHijacked, http.StateClosed:
+		t.open.Add(-1)
+		t.accepted.Delete(c)
+		t.cancelIdleClose(c)
+	}
+}
+
+// Close c after idleClose unless a new request arrives first
+func (t *connTracker) closeWhenIdle(c net.Conn) {
+	it := &idleTimer{}
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	it.timer = time.AfterFunc(idleClose, func() {
+		it.mu.Lock()
+		defer it.mu.Unlock()
+		// Lost the race with a request starting on the connection
+		if it.stopped {
+			return
+		}
+		connIdleClosedTotal.Inc()
+		c.Close()
+	})
+	t.idleTimers.Store(c, it)
+}
+
+func (t *connTracker) cancelIdleClose(c net.Conn) {
+	v, ok := t.idleTimers.LoadAndDelete(c)
+	if !ok {
+		return
+	}
+	it := v.(*idleTimer)
+	it.mu.Lock()
+	it.stopped = true
+	it.timer.Stop()
+	it.mu.Unlock()
+}
+
+type connKey struct{}
+
+// http.Server.ConnContext callback making the connection available to handlers
+func (t *connTracker) connContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+// Observe accept-to-handler time if r is the first request on its connection
+func (t *connTracker) observeFirstRequest(r *http.Request, start time.Time) {
+	c, ok := r.Context().Value(connKey{}).(net.Conn)
+	if !ok {
+		return
+	}
+	if v, ok := t.accepted.LoadAndDelete(c); ok {
+		acceptToHandler.Observe(start.Sub(v.(time.Time)).Seconds())
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Gauge for the /api latency after adding the contention term
+	apiEffectiveLatency = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "api_effective_latency_seconds",
+			Help: "Mean simulated /api latency including the QPS-driven contention term",
+		},
+	)
+
+	// Extra /api latency per request per second of load, from LATENCY_PER_QPS; 0 disables
+	latencyPerQPS time.Duration
+
+	// Cap on the contention-adjusted latency, from LATENCY_CONTENTION_MAX
+	contentionMaxLatency = maxAPILatency
+
+	// Last whole-second QPS, published by calculateQPS
+	lastQPS atomic.Int64
+)
+
+// Mean latency of path: its override or the /api base latency, raised to any
+// active /admin/spike latency, plus latencyPerQPS for every request per second
+// currently served, so load slows the service until it scales out
+func effectiveAPILatency(path string) time.Duration {
+	d, ok := latencyOverride(path)
+	if !ok {
+		d = time.Duration(apiLatency.Load())
+	}
+	if spike, ok := activeSpike(time.Now()); ok {
+		d = max(d, spike)
+	}
+	if latencyPerQPS > 0 {
+		d += latencyPerQPS * time.Duration(lastQPS.Load())
+		d = min(d, contentionMaxLatency)
+	}
+	apiEffectiveLatency.Set(d.Seconds())
+	return d
+}
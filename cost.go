@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Counter for the cost of served requests
+	requestCostTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "request_cost_total",
+			Help: "Total cost of requests, where a plain request costs 1 and handlers annotate heavier work",
+		},
+		[]string{"path"},
+	)
+
+	// Gauge for request cost per second over the QPS window
+	requestCostPerSecond = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "request_cost_per_second",
+			Help: "Request cost per second over the QPS window, a work-weighted alternative to http_requests_per_second",
+		},
+	)
+
+	// Cumulative cost in thousandths, sampled by calculateQPS
+	costCounter atomic.Uint64
+)
+
+// Cost of a plain request, and the burn time that costs as much
+const (
+	defaultRequestCost = 1
+	burnCostUnit       = 10 * time.Millisecond
+)
+
+// Cost of one request, set by its handler through setRequestCost
+type requestCost struct {
+	value atomic.Uint64 // math.Float64bits
+}
+
+type requestCostKey struct{}
+
+// Attach a cost holder, defaulting to a plain request's cost
+func withRequestCost(r *http.Request) (*http.Request, *requestCost) {
+	c := &requestCost{}
+	c.value.Store(math.Float64bits(defaultRequestCost))
+	return r.WithContext(context.WithValue(r.Context(), requestCostKey{}, c)), c
+}
+
+// Annotate the cost of the current request, in plain-request units
+func setRequestCost(r *http.Request, cost float64) {
+	if c, ok := r.Context().Value(requestCostKey{}).(*requestCost); ok {
+		c.value.Store(math.Float64bits(cost))
+	}
+}
+
+func (c *requestCost) get() float64 {
+	return math.Float64frombits(c.value.Load())
+}
+
+// Account a finished request's cost
+func recordRequestCost(path string, cost float64) {
+	requestCostTotal.WithLabelValues(path).Add(cost)
+	costCounter.Add(uint64(cost * 1000))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Handlers annotate the cost of heavier requests; everything else costs one
+// plain request, and the window rate follows the costs served
+func TestRequestCost(t *testing.T) {
+	setAtomic(t, &apiLatency, 0)
+	setAtomic(t, &qpsWindow, 3)
+	setVar(t, &burnCoalesce, false)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		target  string
+		cost    float64
+	}{
+		{"plain request", func(w http.ResponseWriter, r *http.Request) {}, "/plain", 1},
+		{"annotated cost", func(w http.ResponseWriter, r *http.Request) { setRequestCost(r, 2.5) }, "/annotated", 2.5},
+		{"api ops", apiHandler, "/api?ops=3", 3},
+		// A rejected request did none of the work it asked for
+		{"invalid api ops", apiHandler, "/api?ops=0", 1},
+		{"burn", burnHandler, "/burn?duration=20ms", 2},
+	}
+
+	c := newQPSCalculator(prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_duration_seconds"}))
+	total := 0.0
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse(tt.target)
+			counter := requestCostTotal.WithLabelValues(u.Path)
+			before, beforeMilli := metricValue(t, counter), costCounter.Load()
+
+			serve(metricsMiddleware(tt.handler), http.MethodGet, tt.target)
+
+			if got := metricValue(t, counter) - before; math.Abs(got-tt.cost) > 1e-9 {
+				t.Errorf("request_cost_total grew by %g, want %g", got, tt.cost)
+			}
+			if got := costCounter.Load() - beforeMilli; got != uint64(tt.cost*1000) {
+				t.Errorf("cost counter grew by %d, want %d", got, uint64(tt.cost*1000))
+			}
+		})
+		total += tt.cost
+	}
+
+	c.tick()
+	if got := metricValue(t, requestCostPerSecond); math.Abs(got-total) > 1e-9 {
+		t.Errorf("request_cost_per_second = %g, want %g", got, total)
+	}
+}
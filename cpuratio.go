@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Histogram for CPU time over wall-clock time per request
+	httpRequestCPURatio = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_request_cpu_ratio",
+			Help:    "CPU time divided by wall-clock time per request; near 1 is CPU-bound, near 0 wait-bound, above 1 parallel",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 0.75, 0.9, 1, 2, 4, 8},
+		},
+		[]string{"path"},
+	)
+
+	// Record http_request_cpu_ratio, from CPU_RATIO. Off by default because it
+	// locks each request to an OS thread, which costs a thread per in-flight
+	// request.
+	cpuRatioEnabled bool
+)
+
+// CPU time attributed to one request, summed over the goroutines that add to it
+type cpuAccount struct {
+	nanos atomic.Int64
+}
+
+type cpuAccountKey struct{}
+
+// Track CPU time for the rest of the goroutine's work on behalf of ctx's
+// request; call the returned function when done. The goroutine is locked to
+// its thread so the thread's CPU clock only counts this goroutine.
+func trackCPU(ctx context.Context) func() {
+	acct, _ := ctx.Value(cpuAccountKey{}).(*cpuAccount)
+	if acct == nil {
+		return func() {}
+	}
+	runtime.LockOSThread()
+	start, ok := threadCPUTime()
+	return func() {
+		if end, endOK := threadCPUTime(); ok && endOK {
+			acct.nanos.Add(int64(end - start))
+		}
+		runtime.UnlockOSThread()
+	}
+}
+
+// Measure the CPU ratio of requests through next, when enabled and supported.
+// Work on other goroutines counts when they call trackCPU, as the burn
+// workers and the /api worker pool do.
+func measureCPURatio(next http.HandlerFunc) http.HandlerFunc {
+	if _, ok := threadCPUTime(); !ok {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !cpuRatioEnabled {
+			next(w, r)
+			return
+		}
+		acct := &cpuAccount{}
+		r = r.WithContext(context.WithValue(r.Context(), cpuAccountKey{}, acct))
+
+		start := time.Now()
+		done := trackCPU(r.Context())
+		next(w, r)
+		done()
+
+		if wall := time.Since(start); wall > 0 {
+			httpRequestCPURatio.WithLabelValues(r.URL.Path).Observe(float64(acct.nanos.Load()) / float64(wall))
+		}
+	}
+}
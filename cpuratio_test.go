@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Spin for d of wall-clock time
+func spin(d time.Duration) {
+	for start := time.Now(); time.Since(start) < d; {
+	}
+}
+
+func TestCPURatio(t *testing.T) {
+	if _, ok := threadCPUTime(); !ok {
+		t.Skip("per-thread CPU time is Linux only")
+	}
+	setVar(t, &cpuRatioEnabled, true)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	pool := newWorkerPool(1, 1)
+	pool.start(ctx)
+
+	busy := func(w http.ResponseWriter, r *http.Request) { spin(50 * time.Millisecond) }
+	idle := func(w http.ResponseWriter, r *http.Request) { time.Sleep(50 * time.Millisecond) }
+	tests := []struct {
+		name     string
+		pool     *workerPool
+		handler  http.HandlerFunc
+		min, max float64
+	}{
+		{"cpu-bound inline", nil, busy, 0.5, 1.2},
+		{"cpu-bound on the worker pool", pool, busy, 0.5, 1.2},
+		{"waiting inline", nil, idle, 0, 0.2},
+		{"waiting on the worker pool", pool, idle, 0, 0.2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setVar(t, &apiPool, tt.pool)
+			ratios := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "test_cpu_ratio"}, []string{"path"})
+			setVar(t, &httpRequestCPURatio, ratios)
+
+			measureCPURatio(pooled(tt.handler))(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api", nil))
+
+			var m dto.Metric
+			ratios.WithLabelValues("/api").(prometheus.Metric).Write(&m)
+			if n := m.GetHistogram().GetSampleCount(); n != 1 {
+				t.Fatalf("%d observations, want 1", n)
+			}
+			if ratio := m.GetHistogram().GetSampleSum(); ratio < tt.min || ratio > tt.max {
+				t.Errorf("cpu ratio %.2f, want between %g and %g", ratio, tt.min, tt.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "time"
+
+// Per-thread CPU time is only read on Linux; elsewhere the CPU ratio is not recorded
+func threadCPUTime() (time.Duration, bool) {
+	return 0, false
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// Shut down gracefully after serving this many requests, from
+	// -max-requests, like an ephemeral worker; 0 never
+	maxRequests uint64
+
+	// Stop after serving this many requests, from CRASH_AFTER_REQUESTS; 0 never
+	crashAfterRequests uint64
+
+	// How to stop, from CRASH_MODE: "shutdown" runs the graceful shutdown,
+	// "panic" crashes the process without flushing anything
+	crashMode = "shutdown"
+
+	// Chance of exiting at startup before binding the port, from
+	// CRASH_ON_START_PROBABILITY, to put pods into CrashLoopBackOff
+	crashOnStartProbability float64
+
+	// Source of the crash-on-start roll, replaced in tests
+	crashOnStartRoll = rand.Float64
+
+	// Requests seen by this process, counted from zero whatever a snapshot
+	// restored; drives -max-requests and CRASH_AFTER_REQUESTS
+	processRequests atomic.Uint64
+
+	// Each trigger fires once, on the first request at or past its count
+	maxRequestsOnce, crashAfterOnce sync.Once
+
+	// Asks main to run the graceful shutdown, as a signal would; carries the reason
+	shutdownRequests = make(chan string, 1)
+)
+
+// Exit non-zero with CRASH_ON_START_PROBABILITY, before the port is bound
+// so the pod never becomes ready
+func maybeCrashOnStart() {
+	if shouldCrashOnStart() {
+		log.Fatalf("Crashing on start (CRASH_ON_START_PROBABILITY=%g)", crashOnStartProbability)
+	}
+}
+
+func shouldCrashOnStart() bool {
+	return crashOnStartProbability > 0 && crashOnStartRoll() < crashOnStartProbability
+}
+
+// Start the graceful shutdown from inside the process; later requests while
+// one is pending are dropped
+func requestShutdown(reason string) {
+	select {
+	case shutdownRequests <- reason:
+	default:
+	}
+}
+
+// Count a request and stop once this process has served -max-requests or
+// CRASH_AFTER_REQUESTS requests
+func checkRequestCount() {
+	n := processRequests.Add(1)
+	if maxRequests > 0 && n >= maxRequests {
+		maxRequestsOnce.Do(func() {
+			logEvent(eventMaxRequestsReached, "Request count reached -max-requests", "requests", n)
+			requestShutdown(fmt.Sprintf("served %d requests (-max-requests)", n))
+		})
+	}
+	checkCrashAfter(n)
+}
+
+func checkCrashAfter(n uint64) {
+	if crashAfterRequests == 0 || n < crashAfterRequests {
+		return
+	}
+	crashAfterOnce.Do(func() {
+		slog.Warn("Request count reached CRASH_AFTER_REQUESTS", "requests", n, "mode", crashMode)
+		if crashMode == "panic" {
+			// On its own goroutine, since net/http recovers panics in handlers
+			go panic(fmt.Sprintf("crash after %d requests requested via CRASH_AFTER_REQUESTS", n))
+			return
+		}
+		requestShutdown(fmt.Sprintf("served %d requests (CRASH_AFTER_REQUESTS)", n))
+	})
+}
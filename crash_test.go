@@ -0,0 +1,106 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+// Reset the request-count triggers, and drop any shutdown they requested
+func resetRequestCount(t *testing.T) {
+	reset := func() {
+		processRequests.Store(0)
+		maxRequestsOnce = sync.Once{}
+		crashAfterOnce = sync.Once{}
+		select {
+		case <-shutdownRequests:
+		default:
+		}
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+// Whether a shutdown was requested, consuming the request
+func shutdownRequested() bool {
+	select {
+	case <-shutdownRequests:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestMaxRequests(t *testing.T) {
+	tests := []struct {
+		name string
+		// Requests restored from a snapshot
+		restored uint64
+	}{
+		{"fresh", 0},
+		{"restored below the limit", 2},
+		{"restored past the limit", 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetRequestCount(t)
+			setVar(t, &maxRequests, 3)
+			setVar(t, &restoredRequests, tt.restored)
+
+			for i := 1; i <= 5; i++ {
+				checkRequestCount()
+				got := shutdownRequested()
+				if want := i == 3; got != want {
+					t.Errorf("request %d: shutdown requested = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCrashAfterRequests(t *testing.T) {
+	tests := []struct {
+		name     string
+		restored uint64
+	}{
+		{"fresh", 0},
+		{"restored below the count", 1},
+		{"restored past the count", 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetRequestCount(t)
+			setVar(t, &crashAfterRequests, 2)
+			setVar(t, &crashMode, "shutdown")
+			setVar(t, &restoredRequests, tt.restored)
+
+			for i := 1; i <= 4; i++ {
+				checkRequestCount()
+				got := shutdownRequested()
+				if want := i == 2; got != want {
+					t.Errorf("request %d: shutdown requested = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCrashOnStart(t *testing.T) {
+	tests := []struct {
+		probability float64
+		roll        float64
+		crash       bool
+	}{
+		{0, 0, false}, // disabled even on the lowest roll
+		{0.5, 0.49, true},
+		{0.5, 0.5, false},
+		{0.5, 0.9, false},
+		{1, 0.999, true},
+	}
+	for _, tt := range tests {
+		setVar(t, &crashOnStartProbability, tt.probability)
+		setVar(t, &crashOnStartRoll, func() float64 { return tt.roll })
+		if got := shouldCrashOnStart(); got != tt.crash {
+			t.Errorf("probability %g, roll %g: crash = %v, want %v", tt.probability, tt.roll, got, tt.crash)
+		}
+	}
+}
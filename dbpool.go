@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Gauge for simulated database connections held by a query
+	dbPoolBusy = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "db_pool_busy_connections",
+			Help: "Simulated /db pool connections currently held by a query",
+		},
+	)
+
+	// Gauge for requests waiting for a free connection
+	dbPoolWaiters = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "db_pool_waiters",
+			Help: "Number of /db requests waiting for a pool connection",
+		},
+	)
+
+	// Counter for requests that gave up waiting for a connection
+	dbPoolTimeoutsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "db_pool_timeouts_total",
+			Help: "Total number of /db requests rejected after waiting DB_ACQUIRE_TIMEOUT for a connection",
+		},
+	)
+
+	// Simulated pool behind /db, sized from DB_POOL_SIZE
+	dbPool = newConnPool(10, 50*time.Millisecond, time.Second)
+)
+
+// Fixed-size pool of simulated database connections; a connection is a slot
+// in a buffered channel
+type connPool struct {
+	conns          chan struct{}
+	queryLatency   time.Duration
+	acquireTimeout time.Duration
+
+	waiters atomic.Int64
+}
+
+func newConnPool(size int, queryLatency, acquireTimeout time.Duration) *connPool {
+	return &connPool{conns: make(chan struct{}, size), queryLatency: queryLatency, acquireTimeout: acquireTimeout}
+}
+
+// Take a connection, waiting up to the acquire timeout or until ctx is done
+func (p *connPool) acquire(ctx context.Context) bool {
+	select {
+	case p.conns <- struct{}{}:
+		dbPoolBusy.Set(float64(len(p.conns)))
+		return true
+	default:
+	}
+
+	dbPoolWaiters.Set(float64(p.waiters.Add(1)))
+	defer func() { dbPoolWaiters.Set(float64(p.waiters.Add(-1))) }()
+
+	timer := time.NewTimer(p.acquireTimeout)
+	defer timer.Stop()
+	select {
+	case p.conns <- struct{}{}:
+		dbPoolBusy.Set(float64(len(p.conns)))
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (p *connPool) release() {
+	<-p.conns
+	dbPoolBusy.Set(float64(len(p.conns)))
+}
+
+// Run a simulated query: hold a pool connection for the query latency.
+// Requests that cannot get a connection in time are rejected with 503, the
+// saturation point a pool-size-bound service hits before its CPU does.
+func dbHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if !dbPool.acquire(r.Context()) {
+		if r.Context().Err() != nil {
+			writeClientClosed(w)
+			return
+		}
+		dbPoolTimeoutsTotal.Inc()
+		writeUnavailable(w, "db_pool_exhausted", "no database connection free within "+dbPool.acquireTimeout.String())
+		return
+	}
+	waited := time.Since(start)
+	defer dbPool.release()
+
+	timer := time.NewTimer(dbPool.queryLatency)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-r.Context().Done():
+		writeClientClosed(w)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"waited": waited.String(),
+		"query":  dbPool.queryLatency.String(),
+	})
+}
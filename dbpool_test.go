@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Queries hold a connection for their latency; clients that give up while
+// waiting or mid-query are counted as 499s rather than successes
+func TestDBHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		held     bool // the only connection is taken by another request
+		latency  time.Duration
+		acquire  time.Duration
+		cancel   time.Duration // client gives up after; 0 never
+		status   int
+		timeouts float64
+	}{
+		{"query", false, 20 * time.Millisecond, time.Second, 0, http.StatusOK, 0},
+		{"pool exhausted", true, 20 * time.Millisecond, 20 * time.Millisecond, 0, http.StatusServiceUnavailable, 1},
+		{"cancelled waiting", true, 20 * time.Millisecond, time.Minute, 20 * time.Millisecond, statusClientClosedRequest, 0},
+		{"cancelled mid-query", false, time.Minute, time.Second, 20 * time.Millisecond, statusClientClosedRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setVar(t, &dbPool, newConnPool(1, tt.latency, tt.acquire))
+			if tt.held {
+				dbPool.acquire(context.Background())
+				t.Cleanup(dbPool.release)
+			}
+			h := metricsMiddleware(dbHandler)
+			status := strconv.Itoa(tt.status)
+			counted := metricValue(t, httpRequestsTotal.WithLabelValues("/db", http.MethodGet, status, "default"))
+			timeouts := metricValue(t, dbPoolTimeoutsTotal)
+
+			ctx := context.Background()
+			if tt.cancel > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.cancel)
+				defer cancel()
+			}
+			rec := httptest.NewRecorder()
+			start := time.Now()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/db", nil).WithContext(ctx))
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("request took %s", elapsed)
+			}
+
+			if rec.Code != tt.status {
+				t.Errorf("status %d, want %d", rec.Code, tt.status)
+			}
+			if got := metricValue(t, httpRequestsTotal.WithLabelValues("/db", http.MethodGet, status, "default")) - counted; got != 1 {
+				t.Errorf("%g requests counted as %s, want 1", got, status)
+			}
+			if got := metricValue(t, dbPoolTimeoutsTotal) - timeouts; got != tt.timeouts {
+				t.Errorf("db_pool_timeouts_total grew by %g, want %g", got, tt.timeouts)
+			}
+			if got, held := len(dbPool.conns), len(dbPool.conns) > 0; held != tt.held {
+				t.Errorf("%d connections held after the request", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Histogram for simulated dependency calls made through /call
+	dependencyCallDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "dependency_call_duration_seconds",
+			Help:    "Latency of simulated dependency calls in seconds, by dependency and result",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"dep", "result"},
+	)
+
+	// Named fake dependencies from DEPENDENCIES
+	dependencies = map[string]dependency{}
+)
+
+// A simulated downstream dependency
+type dependency struct {
+	latency   time.Duration
+	errorRate float64
+}
+
+// Parse comma-separated name=latency[:error_rate] entries,
+// e.g. "db=20ms:0.01,cache=2ms,payments=150ms:0.05"
+func parseDependencies(value string) (map[string]dependency, error) {
+	deps := map[string]dependency{}
+	for _, spec := range strings.Split(value, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		name, rest, ok := strings.Cut(spec, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("dependency %q: want name=latency[:error_rate]", spec)
+		}
+		if _, dup := deps[name]; dup {
+			return nil, fmt.Errorf("dependency %q: duplicate name", name)
+		}
+		latency, rate, hasRate := strings.Cut(rest, ":")
+
+		var dep dependency
+		var err error
+		if dep.latency, err = time.ParseDuration(latency); err != nil || dep.latency < 0 || dep.latency > maxAPILatency {
+			return nil, fmt.Errorf("dependency %q: latency must be a duration between 0 and %s", name, maxAPILatency)
+		}
+		if hasRate {
+			if dep.errorRate, err = strconv.ParseFloat(rate, 64); err != nil || dep.errorRate < 0 || dep.errorRate > 1 {
+				return nil, fmt.Errorf("dependency %q: error rate must be in [0,1]", name)
+			}
+		}
+		deps[name] = dep
+	}
+	return deps, nil
+}
+
+// Call one simulated dependency: /call?dep=db
+func callHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("dep")
+	dep, ok := dependencies[name]
+	if !ok {
+		names := make([]string, 0, len(dependencies))
+		for n := range dependencies {
+			names = append(names, n)
+		}
+		slices.Sort(names)
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("unknown dependency %q, configured: %s", name, strings.Join(names, ", ")))
+		return
+	}
+
+	start := time.Now()
+	err := callDownstream(r.Context(), dep.latency, dep.errorRate)
+	duration := time.Since(start)
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	dependencyCallDuration.WithLabelValues(name, result).Observe(duration.Seconds())
+	if err != nil {
+		writeJSONError(w, http.StatusBadGateway, fmt.Sprintf("dependency %s failed: %v", name, err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"dep":      name,
+		"duration": duration.String(),
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestParseDependencies(t *testing.T) {
+	tests := []struct {
+		value string
+		deps  map[string]dependency // nil for an error
+	}{
+		{"", map[string]dependency{}},
+		{"db=20ms:0.01, cache=2ms", map[string]dependency{
+			"db":    {latency: 20 * time.Millisecond, errorRate: 0.01},
+			"cache": {latency: 2 * time.Millisecond},
+		}},
+		{"db", nil},
+		{"=20ms", nil},
+		{"db=20ms,db=30ms", nil},
+		{"db=slow", nil},
+		{"db=-1ms", nil},
+		{"db=20ms:2", nil},
+		{"db=20ms:often", nil},
+	}
+	for _, tt := range tests {
+		deps, err := parseDependencies(tt.value)
+		if tt.deps == nil {
+			if err == nil {
+				t.Errorf("%q: no error", tt.value)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(deps, tt.deps) {
+			t.Errorf("%q: %v, error %v, want %v", tt.value, deps, err, tt.deps)
+		}
+	}
+}
+
+// Each dependency answers with its own latency and error rate, recorded
+// under its own name
+func TestCallDependencies(t *testing.T) {
+	deps, err := parseDependencies("fast=1ms,slow=60ms,broken=1ms:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setVar(t, &dependencies, deps)
+
+	tests := []struct {
+		dep      string
+		status   int
+		result   string
+		min, max time.Duration // mean observed latency
+	}{
+		{"fast", http.StatusOK, "success", time.Millisecond, 30 * time.Millisecond},
+		{"slow", http.StatusOK, "success", 60 * time.Millisecond, 120 * time.Millisecond},
+		{"broken", http.StatusBadGateway, "error", 0, 30 * time.Millisecond},
+		{"missing", http.StatusNotFound, "", 0, 0},
+	}
+	for _, tt := range tests {
+		var hist prometheus.Metric
+		var count uint64
+		var sum float64
+		if tt.result != "" {
+			hist = dependencyCallDuration.WithLabelValues(tt.dep, tt.result).(prometheus.Metric)
+			count, sum = histogramValue(t, hist)
+		}
+
+		for range 3 {
+			if rec := serve(http.HandlerFunc(callHandler), http.MethodGet, "/call?dep="+tt.dep); rec.Code != tt.status {
+				t.Errorf("%s: status %d, want %d", tt.dep, rec.Code, tt.status)
+			}
+		}
+		if hist == nil {
+			continue
+		}
+		newCount, newSum := histogramValue(t, hist)
+		if newCount-count != 3 {
+			t.Errorf("%s: %d %s observations, want 3", tt.dep, newCount-count, tt.result)
+			continue
+		}
+		mean := time.Duration((newSum - sum) / 3 * float64(time.Second))
+		if mean < tt.min || mean > tt.max {
+			t.Errorf("%s: mean latency %s, want between %s and %s", tt.dep, mean, tt.min, tt.max)
+		}
+	}
+}
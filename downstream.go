@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Histogram for the total time spent on simulated downstream calls per request
+	downstreamDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "downstream_duration_seconds",
+			Help:    "Total time spent on simulated downstream calls per /api request",
+			Buckets: prometheus.DefBuckets,
+		},
+	)
+)
+
+// Simulated downstream fan-out performed by each /api request
+type downstreamConfig struct {
+	// Number of downstream calls per request; 0 disables fan-out
+	calls int
+	// Issue the calls concurrently instead of one after another
+	parallel bool
+	// Artificial latency of each call
+	latency time.Duration
+	// Fraction of calls that fail, injected to simulate a downstream outage
+	errorRate float64
+}
+
+// Error returned by calls that fail through error injection
+var errDownstreamInjected = errors.New("injected downstream error")
+
+var downstream = downstreamConfig{latency: 5 * time.Millisecond}
+
+// Simulate a single downstream call
+func callDownstream(ctx context.Context, latency time.Duration, errorRate float64) error {
+	timer := time.NewTimer(latency)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		if errorRate > 0 && rand.Float64() < errorRate {
+			return errDownstreamInjected
+		}
+		return nil
+	}
+}
+
+// Run the configured fan-out and record its total duration
+func fanOut(ctx context.Context, cfg downstreamConfig) error {
+	if cfg.calls <= 0 {
+		return nil
+	}
+
+	start := time.Now()
+	defer func() {
+		downstreamDuration.Observe(secondsSince(start))
+	}()
+
+	if !cfg.parallel {
+		for i := 0; i < cfg.calls; i++ {
+			if err := callDownstream(ctx, cfg.latency, cfg.errorRate); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	errs := make(chan error, cfg.calls)
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.calls; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- callDownstream(ctx, cfg.latency, cfg.errorRate)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
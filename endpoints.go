@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Runtime on/off switch for one route: 0 while enabled, otherwise the status
+// (404 or 503) requests to it are answered with
+type endpointToggle struct {
+	disabledStatus atomic.Int32
+}
+
+// Answer requests with the disabled status while the route is switched off
+func (t *endpointToggle) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch t.disabledStatus.Load() {
+		case 0:
+			next.ServeHTTP(w, r)
+		case http.StatusServiceUnavailable:
+			writeUnavailable(w, "endpoint_disabled", "endpoint disabled")
+		default:
+			writeErrorBody(w, errorBody{Code: http.StatusNotFound, Message: "endpoint disabled", Reason: "endpoint_disabled"})
+		}
+	})
+}
+
+// Routes under /admin/ and the probes cannot be switched off, so the switch
+// itself stays reachable and the kubelet keeps its view of the pod
+func toggleable(path string) bool {
+	return !strings.HasPrefix(path, "/admin/") && !isProbePath(path)
+}
+
+// Report the enabled state of every switchable route
+func (rt *router) endpointStates() map[string]bool {
+	states := make(map[string]bool, len(rt.toggles))
+	for path, t := range rt.toggles {
+		states[path] = t.disabledStatus.Load() == 0
+	}
+	return states
+}
+
+// Report (GET) or change (POST/PUT ?path=/api&enabled=false[&status=503])
+// which routes are enabled. Disabled routes answer 404 by default, or 503.
+func (rt *router) adminEndpointsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		q := r.URL.Query()
+		t, ok := rt.toggles[q.Get("path")]
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, fmt.Sprintf("no switchable route %q", q.Get("path")))
+			return
+		}
+		enabled, err := strconv.ParseBool(q.Get("enabled"))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "enabled must be true or false")
+			return
+		}
+		status := http.StatusNotFound
+		if v := q.Get("status"); v != "" {
+			status, err = strconv.Atoi(v)
+			if err != nil || (status != http.StatusNotFound && status != http.StatusServiceUnavailable) {
+				writeJSONError(w, http.StatusBadRequest, "status must be 404 or 503")
+				return
+			}
+		}
+		if enabled {
+			status = 0
+		}
+		t.disabledStatus.Store(int32(status))
+		events.add(eventSettingChanged, "Endpoint toggled", "path", q.Get("path"), "enabled", enabled)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"endpoints": rt.endpointStates()})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Largest request body accepted by limitBody routes, from MAX_BODY_BYTES
+var maxBodyBytes int64 = 1 << 20
+
+// Enforce maxBodyBytes. A declared Content-Length over the limit is rejected
+// with 413 before the body is read, so clients sending "Expect: 100-continue"
+// get the rejection instead of a 100 and never upload the body; net/http only
+// sends the 100 once the handler starts reading. Chunked bodies are cut off
+// by MaxBytesReader once they exceed the limit. Unsupported Expect values are
+// answered with 417 by net/http before any handler runs.
+func limitBody(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > maxBodyBytes {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", maxBodyBytes))
+			return
+		}
+		r.Body = http.MaxBytesReader(baseWriter(w), r.Body, maxBodyBytes)
+		next(w, r)
+	}
+}
+
+// The server's own writer beneath the middleware wrappers. MaxBytesReader
+// needs it to close the connection once a body runs over the limit, rather
+// than leave the unread rest of the upload on a keep-alive connection.
+func baseWriter(w http.ResponseWriter) http.ResponseWriter {
+	for {
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return w
+		}
+		w = u.Unwrap()
+	}
+}
+
+// Accept an upload and report its size: POST /enqueue
+func enqueueHandler(w http.ResponseWriter, r *http.Request) {
+	n, err := io.Copy(io.Discard, r.Body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", maxErr.Limit))
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, "reading request body failed: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"status": "accepted",
+		"bytes":  n,
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Raw connection to srv, so interim responses and closes are visible
+func dialRaw(t *testing.T, srv *httptest.Server) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn, bufio.NewReader(conn)
+}
+
+func TestEnqueueExpectContinue(t *testing.T) {
+	setVar(t, &maxBodyBytes, 1024)
+	srv := httptest.NewServer(newTestRouter(t))
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name    string
+		expect  string
+		length  int
+		interim bool // 100 Continue before the final status
+		status  int
+	}{
+		{"within the limit", "100-continue", 512, true, http.StatusAccepted},
+		{"declared over the limit", "100-continue", 2048, false, http.StatusRequestEntityTooLarge},
+		{"unsupported expectation", "something-else", 512, false, http.StatusExpectationFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, br := dialRaw(t, srv)
+			fmt.Fprintf(conn, "POST /enqueue HTTP/1.1\r\nHost: test\r\nContent-Length: %d\r\nExpect: %s\r\n\r\n", tt.length, tt.expect)
+
+			// Only send the body once the server asks for it
+			status, err := br.ReadString('\n')
+			if err != nil {
+				t.Fatalf("reading status: %v", err)
+			}
+			if got := strings.Contains(status, " 100 "); got != tt.interim {
+				t.Fatalf("first status line %q, want 100 Continue: %v", status, tt.interim)
+			}
+			if tt.interim {
+				br.ReadString('\n') // blank line ending the interim response
+				conn.Write([]byte(strings.Repeat("x", tt.length)))
+				status, _ = br.ReadString('\n')
+			}
+			if !strings.Contains(status, fmt.Sprintf(" %d ", tt.status)) {
+				t.Errorf("final status line %q, want %d", status, tt.status)
+			}
+		})
+	}
+}
+
+// A chunked body only turns out too large while it is read; the connection
+// is closed after the 413 instead of being kept alive with the rest unread
+func TestEnqueueChunkedOverLimit(t *testing.T) {
+	setVar(t, &maxBodyBytes, 1024)
+	srv := httptest.NewServer(newTestRouter(t))
+	t.Cleanup(srv.Close)
+
+	conn, br := dialRaw(t, srv)
+	fmt.Fprintf(conn, "POST /enqueue HTTP/1.1\r\nHost: test\r\nTransfer-Encoding: chunked\r\n\r\n%x\r\n%s\r\n0\r\n\r\n", 2048, strings.Repeat("x", 2048))
+
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("status %d, want 413", resp.StatusCode)
+	}
+	if !resp.Close {
+		t.Error("response does not close the connection")
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		t.Errorf("connection still open after the 413: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Gauge for the rolling 5xx ratio over the configured window
+	httpErrorRatio = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "http_error_ratio",
+			Help: "Ratio of 5xx responses to all responses over the rolling window",
+		},
+	)
+
+	// Gauge for the 5xx ratio over the QPS window, the same seconds as
+	// http_requests_per_second; short and without a minimum request count,
+	// for fast feedback rather than alerting
+	httpErrorRate = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "http_error_rate",
+			Help: "Ratio of 5xx responses to all responses over the QPS window",
+		},
+	)
+
+	// Gauge set to 1 while the error ratio is above the configured threshold
+	httpErrorRatioBreached = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "http_error_ratio_breached",
+			Help: "1 if http_error_ratio is above the configured threshold, 0 otherwise",
+		},
+	)
+
+	// Counter of 5xx responses for the error ratio calculation
+	errorCounter uint64
+)
+
+// Settings for the rolling error ratio
+type errorRatioConfig struct {
+	// Rolling window the ratio is computed over
+	window time.Duration
+	// Ratio above which http_error_ratio_breached is set
+	threshold float64
+	// Fewer requests than this in the window report a ratio of 0
+	minRequests uint64
+}
+
+var defaultErrorRatioConfig = errorRatioConfig{
+	window:      time.Minute,
+	threshold:   0.05,
+	minRequests: 10,
+}
+
+// Cumulative counter sample, one per second of the window
+type errorSample struct{ total, errors uint64 }
+
+// Rolling error ratio state, advanced once per second by tick
+type errorRatioCalculator struct {
+	cfg     errorRatioConfig
+	size    int
+	samples []errorSample
+}
+
+func newErrorRatioCalculator(cfg errorRatioConfig) *errorRatioCalculator {
+	size := int(cfg.window / time.Second)
+	if size < 1 {
+		size = 1
+	}
+	return &errorRatioCalculator{cfg: cfg, size: size, samples: make([]errorSample, 0, size+1)}
+}
+
+// Error ratio calculator runs in background, sampling the counters every second
+func calculateErrorRatio(ctx context.Context, cfg errorRatioConfig) {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	c := newErrorRatioCalculator(cfg)
+	hb := newHeartbeat("error_ratio", time.Second)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			hb.beat()
+			c.tick()
+		}
+	}
+}
+
+// Sample the counters and publish the ratio over the window
+func (c *errorRatioCalculator) tick() {
+	c.samples = append(c.samples, errorSample{
+		total:  atomic.LoadUint64(&requestCounter),
+		errors: atomic.LoadUint64(&errorCounter),
+	})
+	if len(c.samples) > c.size+1 {
+		c.samples = c.samples[1:]
+	}
+
+	oldest, newest := c.samples[0], c.samples[len(c.samples)-1]
+	total := newest.total - oldest.total
+	errors := newest.errors - oldest.errors
+
+	ratio := 0.0
+	if total >= c.cfg.minRequests && total > 0 {
+		ratio = float64(errors) / float64(total)
+	}
+	httpErrorRatio.Set(ratio)
+	if ratio > c.cfg.threshold {
+		httpErrorRatioBreached.Set(1)
+	} else {
+		httpErrorRatioBreached.Set(0)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The ratio follows the 5xx share of the last window, reporting 0 below the
+// minimum request count, and flags a breach above the threshold
+func TestErrorRatio(t *testing.T) {
+	setVar(t, &requestCounter, 0)
+	setVar(t, &errorCounter, 0)
+	c := newErrorRatioCalculator(errorRatioConfig{window: 3 * time.Second, threshold: 0.1, minRequests: 10})
+
+	tests := []struct {
+		requests, errors uint64 // during the second before the tick
+		ratio            float64
+		breached         bool
+	}{
+		{0, 0, 0, false},         // first sample, nothing to compare with
+		{5, 5, 0, false},         // below the minimum request count
+		{5, 0, 0.5, true},        // 5 of 10
+		{10, 0, 0.25, true},      // 5 of 20
+		{10, 1, 1.0 / 25, false}, // window full, the erroring second rolled out
+		{10, 0, 1.0 / 30, false}, // 1 of 30
+		{10, 0, 1.0 / 30, false}, // 1 of 30
+		{10, 0, 0, false},        // converged back to no errors
+		{0, 0, 0, false},         // 0 of 20
+		{0, 0, 0, false},         // below the minimum again as traffic stops
+	}
+	for i, tt := range tests {
+		atomic.AddUint64(&requestCounter, tt.requests)
+		atomic.AddUint64(&errorCounter, tt.errors)
+		c.tick()
+		if got := metricValue(t, httpErrorRatio); math.Abs(got-tt.ratio) > 1e-9 {
+			t.Errorf("tick %d: ratio %g, want %g", i+1, got, tt.ratio)
+		}
+		breached := metricValue(t, httpErrorRatioBreached) == 1
+		if breached != tt.breached {
+			t.Errorf("tick %d: breached %v, want %v", i+1, breached, tt.breached)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// One entry of the in-memory event log
+type eventRecord struct {
+	Time    time.Time      `json:"time"`
+	Event   string         `json:"event"`
+	Message string         `json:"message"`
+	Attrs   map[string]any `json:"attrs,omitempty"`
+	// Repeats folded into this entry, e.g. a burst of sheds for one reason;
+	// Time is that of the latest
+	Count int `json:"count"`
+}
+
+// Ring buffer of the most recent events. Consecutive events with the same
+// name and attributes are folded into one entry so a flood of sheds cannot
+// push everything else out.
+type eventLog struct {
+	mu      sync.Mutex
+	entries []eventRecord
+	next    int
+	full    bool
+}
+
+func newEventLog(size int) *eventLog {
+	return &eventLog{entries: make([]eventRecord, size)}
+}
+
+// Recent events, from EVENT_LOG_SIZE
+var events = newEventLog(200)
+
+func (l *eventLog) add(event, msg string, attrs ...any) {
+	now := time.Now()
+	fields := attrMap(attrs)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.next > 0 || l.full {
+		last := &l.entries[(l.next-1+len(l.entries))%len(l.entries)]
+		if last.Event == event && last.Message == msg && fmt.Sprint(last.Attrs) == fmt.Sprint(fields) {
+			last.Count++
+			last.Time = now
+			return
+		}
+	}
+	l.entries[l.next] = eventRecord{Time: now, Event: event, Message: msg, Attrs: fields, Count: 1}
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Up to limit entries, newest first
+func (l *eventLog) recent(limit int) []eventRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := l.next
+	if l.full {
+		n = len(l.entries)
+	}
+	n = min(n, limit)
+	out := make([]eventRecord, 0, n)
+	for i := 1; i <= n; i++ {
+		out = append(out, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+	return out
+}
+
+// Key/value pairs as passed to slog, as a map
+func attrMap(attrs []any) map[string]any {
+	if len(attrs) == 0 {
+		return nil
+	}
+	m := make(map[string]any, len(attrs)/2)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		m[fmt.Sprint(attrs[i])] = attrs[i+1]
+	}
+	return m
+}
+
+// Report recent events, newest first; ?limit= caps the count
+func adminEventsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := len(events.entries)
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeJSONError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"events": events.recent(limit)})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// Event name and fold count of each entry, newest first
+func eventSummary(records []eventRecord) []string {
+	out := []string{}
+	for _, e := range records {
+		out = append(out, fmt.Sprintf("%s x%d", e.Event, e.Count))
+	}
+	return out
+}
+
+func TestEventLogRing(t *testing.T) {
+	type add struct {
+		event string
+		attrs []any
+	}
+	tests := []struct {
+		name string
+		adds []add
+		want []string
+	}{
+		{"empty", nil, []string{}},
+		{"partial", []add{{"a", nil}, {"b", nil}}, []string{"b x1", "a x1"}},
+		{"wraps around", []add{{"a", nil}, {"b", nil}, {"c", nil}, {"d", nil}}, []string{"d x1", "c x1", "b x1"}},
+		{"folds repeats", []add{{"a", nil}, {"shed", []any{"reason", "x"}}, {"shed", []any{"reason", "x"}}, {"shed", []any{"reason", "x"}}}, []string{"shed x3", "a x1"}},
+		{"different attrs stay apart", []add{{"shed", []any{"reason", "x"}}, {"shed", []any{"reason", "y"}}}, []string{"shed x1", "shed x1"}},
+		{"only consecutive repeats fold", []add{{"a", nil}, {"b", nil}, {"a", nil}}, []string{"a x1", "b x1", "a x1"}},
+		// Folding into the newest entry works across the wrap point too
+		{"folds after wrapping", []add{{"a", nil}, {"b", nil}, {"c", nil}, {"c", nil}, {"d", nil}, {"d", nil}}, []string{"d x2", "c x2", "b x1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newEventLog(3)
+			for _, a := range tt.adds {
+				l.add(a.event, a.event+" happened", a.attrs...)
+			}
+			if got := eventSummary(l.recent(10)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("recent = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdminEvents(t *testing.T) {
+	l := newEventLog(10)
+	for _, e := range []string{"a", "b", "c"} {
+		l.add(e, e+" happened")
+	}
+	setVar(t, &events, l)
+
+	tests := []struct {
+		target string
+		status int
+		want   []string
+	}{
+		{"/admin/events", http.StatusOK, []string{"c x1", "b x1", "a x1"}},
+		{"/admin/events?limit=2", http.StatusOK, []string{"c x1", "b x1"}},
+		{"/admin/events?limit=0", http.StatusBadRequest, nil},
+		{"/admin/events?limit=many", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		rec := serve(http.HandlerFunc(adminEventsHandler), http.MethodGet, tt.target)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.target, rec.Code, tt.status)
+			continue
+		}
+		if tt.want == nil {
+			continue
+		}
+		var body struct{ Events []eventRecord }
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: decode body: %v", tt.target, err)
+		}
+		if got := eventSummary(body.Events); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: events = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
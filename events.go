@@ -0,0 +1,44 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+)
+
+// Lifecycle event names, the value of the "event" field
+const (
+	eventStartupComplete    = "startup_complete"
+	eventReadinessChanged   = "readiness_changed"
+	eventWarmupComplete     = "warmup_complete"
+	eventLoopStalled        = "loop_stalled"
+	eventMaxRequestsReached = "max_requests_reached"
+	eventRequestShed        = "request_shed"
+	eventPanicRecovered     = "panic_recovered"
+	eventSettingChanged     = "setting_changed"
+	eventSpikeStarted       = "spike_started"
+	eventSpikeEnded         = "spike_ended"
+	eventShutdownStarted    = "shutdown_started"
+	eventDrainStarted       = "drain_started"
+	eventShutdownPhase      = "shutdown_phase"
+	eventShutdownComplete   = "shutdown_complete"
+)
+
+// Send all logging, including the log package, through a JSON slog handler so
+// lines are machine-parseable
+func setupLogging() {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+}
+
+// Emit a structured lifecycle event with a consistent "event" field, and
+// keep it in the /admin/events log
+func logEvent(event, msg string, attrs ...any) {
+	slog.Info(msg, append([]any{"event", event}, attrs...)...)
+	events.add(event, msg, attrs...)
+}
+
+// Flip readiness and log the change
+func setReady(value bool, reason string) {
+	if ready.Swap(value) != value {
+		logEvent(eventReadinessChanged, "Readiness changed", "ready", value, "reason", reason)
+	}
+}
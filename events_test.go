@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"testing"
+)
+
+// Capture structured log output for the rest of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	old := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(old) })
+	setVar(t, &events, newEventLog(50))
+	return &buf
+}
+
+// Lifecycle events are JSON lines with an event field, in the order they happened
+func TestLifecycleEvents(t *testing.T) {
+	logs := captureLogs(t)
+	setBool(t, &ready, false)
+
+	setReady(true, "server started")
+	setReady(true, "server started") // no change, no event
+	logEvent(eventStartupComplete, "Server started", "addr", ":8080")
+	runShutdown(context.Background(), []shutdownPhase{
+		{"readiness", func(ctx context.Context) error {
+			setReady(false, "shutting down")
+			return nil
+		}},
+		{"reject", func(ctx context.Context) error {
+			logEvent(eventDrainStarted, "Drain started")
+			return nil
+		}},
+	})
+	logEvent(eventShutdownComplete, "Server stopped")
+
+	tests := []struct {
+		event string
+		attrs map[string]any
+	}{
+		{eventReadinessChanged, map[string]any{"ready": true, "reason": "server started"}},
+		{eventStartupComplete, map[string]any{"addr": ":8080"}},
+		{eventShutdownPhase, map[string]any{"phase": "readiness", "status": "started"}},
+		{eventReadinessChanged, map[string]any{"ready": false, "reason": "shutting down"}},
+		{eventShutdownPhase, map[string]any{"phase": "readiness", "status": "completed"}},
+		{eventShutdownPhase, map[string]any{"phase": "reject", "status": "started"}},
+		{eventDrainStarted, nil},
+		{eventShutdownPhase, map[string]any{"phase": "reject", "status": "completed"}},
+		{eventShutdownComplete, nil},
+	}
+	var lines []map[string]any
+	sc := bufio.NewScanner(logs)
+	for sc.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &line); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", sc.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != len(tests) {
+		t.Fatalf("%d log lines, want %d:\n%s", len(lines), len(tests), logs)
+	}
+	for i, tt := range tests {
+		line := lines[i]
+		if line["event"] != tt.event || line["level"] != "INFO" || line["msg"] == "" {
+			t.Errorf("line %d: %v, want an INFO %s event", i+1, line, tt.event)
+		}
+		for k, v := range tt.attrs {
+			if !reflect.DeepEqual(line[k], v) {
+				t.Errorf("line %d (%s): %s = %v, want %v", i+1, tt.event, k, line[k], v)
+			}
+		}
+	}
+
+	// The same events land in the /admin/events log, newest first
+	recent := events.recent(len(tests))
+	for i, tt := range tests {
+		if got := recent[len(tests)-1-i].Event; got != tt.event {
+			t.Errorf("event log entry %d: %s, want %s", i+1, got, tt.event)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// Settings for /flaky, from -flaky-error-rate, -success-latency and -error-latency
+var (
+	flakyErrorRate      = 0.2
+	flakySuccessLatency = 10 * time.Millisecond
+	flakyErrorLatency   = 10 * time.Millisecond
+)
+
+// Fail a configurable fraction of requests, with separate latency for
+// successes and failures to model fail-fast or fail-slow dependencies
+func flakyHandler(w http.ResponseWriter, r *http.Request) {
+	failed := rand.Float64() < flakyErrorRate
+
+	latency := flakySuccessLatency
+	if failed {
+		latency = flakyErrorLatency
+	}
+
+	timer := time.NewTimer(latency)
+	defer timer.Stop()
+	select {
+	case <-r.Context().Done():
+		writeClientClosed(w)
+		return
+	case <-timer.C:
+	}
+
+	if failed {
+		writeJSONError(w, http.StatusInternalServerError, "simulated failure")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Successes and failures each take their own configured latency
+func TestFlakyLatency(t *testing.T) {
+	tests := []struct {
+		name            string
+		errorRate       float64
+		success, errLat time.Duration
+		status          int
+		min, max        time.Duration
+	}{
+		{"fast failure", 1, 200 * time.Millisecond, 0, http.StatusInternalServerError, 0, 100 * time.Millisecond},
+		{"slow failure", 1, 0, 150 * time.Millisecond, http.StatusInternalServerError, 150 * time.Millisecond, time.Second},
+		{"fast success", 0, 0, 200 * time.Millisecond, http.StatusOK, 0, 100 * time.Millisecond},
+		{"slow success", 0, 150 * time.Millisecond, 0, http.StatusOK, 150 * time.Millisecond, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setVar(t, &flakyErrorRate, tt.errorRate)
+			setVar(t, &flakySuccessLatency, tt.success)
+			setVar(t, &flakyErrorLatency, tt.errLat)
+
+			start := time.Now()
+			rec := serve(http.HandlerFunc(flakyHandler), http.MethodGet, "/flaky")
+			elapsed := time.Since(start)
+			if rec.Code != tt.status {
+				t.Errorf("status %d, want %d", rec.Code, tt.status)
+			}
+			if elapsed < tt.min || elapsed > tt.max {
+				t.Errorf("took %s, want between %s and %s", elapsed, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+// A client going away ends the wait and is counted as a 499, not a success
+func TestFlakyCancelled(t *testing.T) {
+	setVar(t, &flakyErrorRate, 1)
+	setVar(t, &flakyErrorLatency, time.Minute)
+	h := metricsMiddleware(flakyHandler)
+	closed := metricValue(t, httpRequestsTotal.WithLabelValues("/flaky", http.MethodGet, "499", "default"))
+	succeeded := metricValue(t, httpRequestsTotal.WithLabelValues("/flaky", http.MethodGet, "200", "default"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/flaky", nil).WithContext(ctx))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("cancelled request took %s", elapsed)
+	}
+	if rec.Code != statusClientClosedRequest || rec.Body.Len() != 0 {
+		t.Errorf("cancelled request got %d %q, want an empty 499", rec.Code, rec.Body)
+	}
+	if got := metricValue(t, httpRequestsTotal.WithLabelValues("/flaky", http.MethodGet, "499", "default")) - closed; got != 1 {
+		t.Errorf("%g requests counted as 499, want 1", got)
+	}
+	if got := metricValue(t, httpRequestsTotal.WithLabelValues("/flaky", http.MethodGet, "200", "default")) - succeeded; got != 0 {
+		t.Errorf("%g requests counted as 200, want 0", got)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Gauge for the rate garbage is generated at
+	gcPressureAllocRate = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "gc_pressure_alloc_bytes_per_second",
+			Help: "Bytes per second of garbage allocated by the GC pressure generator",
+		},
+	)
+
+	// Garbage to allocate per second, from GC_PRESSURE_MB_PER_SEC; 0 disables it
+	gcPressureMBPerSec float64
+
+	// Last allocation, kept reachable until the next one so the compiler
+	// cannot elide the allocations
+	gcPressureSink []byte
+)
+
+// Interval between allocation bursts, and the size of each allocation
+const (
+	gcPressureTick  = 100 * time.Millisecond
+	gcPressureChunk = 64 << 10
+)
+
+// Allocate and drop mbPerSec of garbage every second, spread over ticks, so
+// the heap keeps growing and the GC runs far more often than the app's own
+// allocations would make it
+func runGCPressure(ctx context.Context, mbPerSec float64) {
+	ticker := time.NewTicker(gcPressureTick)
+	defer ticker.Stop()
+	hb := newHeartbeat("gc_pressure", gcPressureTick)
+
+	perTick := int(mbPerSec * (1 << 20) * gcPressureTick.Seconds())
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			gcPressureAllocRate.Set(0)
+			return
+		case now := <-ticker.C:
+			hb.beat()
+			allocated := 0
+			for allocated < perTick {
+				chunk := make([]byte, min(gcPressureChunk, perTick-allocated))
+				// Touch the memory so it is really backed, not just reserved
+				for i := 0; i < len(chunk); i += 4096 {
+					chunk[i] = 1
+				}
+				gcPressureSink = chunk
+				allocated += len(chunk)
+			}
+			gcPressureAllocRate.Set(float64(allocated) / now.Sub(last).Seconds())
+			last = now
+		}
+	}
+}
@@ -2,14 +2,23 @@ module github-vcf.devops.broadcom.net/vcf/scaling-poc
 
 go 1.24.4
 
-require github.com/prometheus/client_golang v1.19.0
+require (
+	github.com/pires/go-proxyproto v0.8.1
+	github.com/prometheus/client_golang v1.19.0
+	github.com/prometheus/client_model v0.5.0
+	github.com/prometheus/common v0.48.0
+	github.com/quic-go/quic-go v0.56.0
+	golang.org/x/sync v0.16.0
+	golang.org/x/sys v0.35.0
+)
 
 require (
 	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
-	github.com/prometheus/client_model v0.5.0 // indirect
-	github.com/prometheus/common v0.48.0 // indirect
 	github.com/prometheus/procfs v0.12.0 // indirect
-	golang.org/x/sys v0.16.0 // indirect
+	github.com/quic-go/qpack v0.5.1 // indirect
+	golang.org/x/crypto v0.41.0 // indirect
+	golang.org/x/net v0.43.0 // indirect
+	golang.org/x/text v0.28.0 // indirect
 	google.golang.org/protobuf v1.32.0 // indirect
 )
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Histogram for the change in goroutine count across a sampled request
+	handlerGoroutineDelta = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "handler_goroutine_delta",
+			Help:    "Goroutines at the end of a sampled request minus at its start; approximate, other requests start and end goroutines too",
+			Buckets: []float64{-10, -5, -2, -1, 0, 1, 2, 5, 10},
+		},
+		[]string{"path"},
+	)
+
+	// Fraction of requests sampled for handler_goroutine_delta, from
+	// GOROUTINE_DELTA_SAMPLE
+	goroutineDeltaSample = 0.01
+)
+
+// Record the goroutine count delta across a sampled fraction of requests.
+// The count is process-wide, so under concurrency a single sample says
+// little: concurrent requests and background loops shift it either way. A
+// leaking handler shows as a mean that stays above zero, which is also the
+// steady climb that eventually forces a scale-up or an OOM.
+func sampleGoroutineDelta(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if goroutineDeltaSample <= 0 || rand.Float64() >= goroutineDeltaSample {
+			next(w, r)
+			return
+		}
+		before := runtime.NumGoroutine()
+		next(w, r)
+		handlerGoroutineDelta.WithLabelValues(r.URL.Path).Observe(float64(runtime.NumGoroutine() - before))
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/quic-go/quic-go/http3"
+)
+
+var (
+	// Counter for requests by HTTP protocol version
+	httpRequestsByProtocol = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_requests_by_protocol_total",
+			Help: "Total number of HTTP requests by protocol: h1, h2 or h3",
+		},
+		[]string{"protocol"},
+	)
+
+	// UDP port for HTTP/3, from HTTP3_PORT; empty disables it. Requires TLS.
+	http3Port string
+)
+
+// Protocol label of a request
+func requestProtocol(r *http.Request) string {
+	switch r.ProtoMajor {
+	case 2:
+		return "h2"
+	case 3:
+		return "h3"
+	}
+	return "h1"
+}
+
+// HTTP/3 server on its own UDP socket, serving the same handler and
+// certificate as the TCP listeners
+type http3Listener struct {
+	server *http3.Server
+	conn   net.PacketConn
+}
+
+// Open the UDP socket now so a taken port fails startup like a TCP one
+func newHTTP3Listener(port string, handler http.Handler, tlsConfig *tls.Config) (*http3Listener, error) {
+	conn, err := net.ListenPacket("udp", net.JoinHostPort("", port))
+	if err != nil {
+		return nil, err
+	}
+	return &http3Listener{
+		server: &http3.Server{
+			Handler:        handler,
+			TLSConfig:      http3.ConfigureTLSConfig(tlsConfig.Clone()),
+			MaxHeaderBytes: maxHeaderBytes,
+			// Advertised in Alt-Svc; known before serving starts
+			Port: conn.LocalAddr().(*net.UDPAddr).Port,
+		},
+		conn: conn,
+	}, nil
+}
+
+func (l *http3Listener) serve() {
+	log.Printf("HTTP/3 listening on %s (udp)", l.conn.LocalAddr())
+	if err := l.server.Serve(l.conn); err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
+		log.Fatalf("HTTP/3 server failed on %s: %v", l.conn.LocalAddr(), err)
+	}
+}
+
+// Advertise HTTP/3 through Alt-Svc on TCP responses so clients can upgrade
+func (l *http3Listener) advertise(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.server.SetQUICHeaders(w.Header())
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Stop accepting connections and wait for clients to close theirs, as
+// server.Shutdown does for TCP. Clients that vanish without closing keep
+// their connection until the QUIC idle timeout, so this often times out.
+func (l *http3Listener) shutdown(ctx context.Context) error {
+	return l.server.Shutdown(ctx)
+}
+
+// Close all connections and the UDP socket immediately
+func (l *http3Listener) close() {
+	l.server.Close()
+	l.conn.Close()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Counter for connections closed by the idle deadline
+	connIdleTimeoutsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "conn_idle_timeouts_total",
+			Help: "Total number of connections closed after CONN_IDLE_TIMEOUT without reads",
+		},
+	)
+
+	// Close connections that send nothing for this long, from CONN_IDLE_TIMEOUT; 0 disables
+	connIdleTimeout time.Duration
+)
+
+// Wrap listeners so every accepted connection gets an idle read deadline
+func withIdleTimeout(listeners []net.Listener, idle time.Duration) []net.Listener {
+	wrapped := make([]net.Listener, len(listeners))
+	for i, ln := range listeners {
+		wrapped[i] = &idleListener{Listener: ln, idle: idle}
+	}
+	return wrapped
+}
+
+type idleListener struct {
+	net.Listener
+	idle time.Duration
+}
+
+func (l *idleListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &idleConn{Conn: c, idle: l.idle}, nil
+}
+
+// Connection whose read deadline is pushed out by idle on every read and
+// write. Deadlines set by net/http are kept when they are sooner, so the
+// server's own read and idle timeouts still apply.
+//
+// net/http reads in the background while a handler runs, so the idle
+// timeout must be longer than the slowest handler that writes nothing.
+type idleConn struct {
+	net.Conn
+	idle time.Duration
+
+	mu sync.Mutex
+	// Read deadline requested by the server; zero means none
+	requested time.Time
+	// Whether the deadline last applied was the idle one, so a timeout is
+	// ours rather than the server interrupting its background read
+	idleApplied bool
+	timedOut    bool
+}
+
+// Apply the sooner of the idle deadline and the requested one
+func (c *idleConn) extend() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	deadline := time.Now().Add(c.idle)
+	c.idleApplied = c.requested.IsZero() || deadline.Before(c.requested)
+	if !c.idleApplied {
+		deadline = c.requested
+	}
+	c.Conn.SetReadDeadline(deadline)
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	c.extend()
+	n, err := c.Conn.Read(b)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		c.mu.Lock()
+		if c.idleApplied && !c.timedOut {
+			c.timedOut = true
+			connIdleTimeoutsTotal.Inc()
+		}
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+func (c *idleConn) Write(b []byte) (int, error) {
+	c.extend()
+	return c.Conn.Write(b)
+}
+
+func (c *idleConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.requested = t
+	c.idleApplied = false
+	c.mu.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *idleConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.requested = t
+	c.idleApplied = false
+	c.mu.Unlock()
+	return c.Conn.SetDeadline(t)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Serve on a loopback listener wrapped with the idle deadline
+func serveIdle(t *testing.T, idle time.Duration, server *http.Server) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "OK")
+	})
+	go server.Serve(withIdleTimeout([]net.Listener{ln}, idle)[0])
+	t.Cleanup(func() { server.Close() })
+	return ln.Addr().String()
+}
+
+// Connections silent for the idle timeout are closed and counted; activity
+// keeps them open, and a sooner server timeout is not counted as ours
+func TestIdleConnTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		idle     time.Duration
+		server   *http.Server
+		requests int // sent 50ms apart before going quiet
+		minOpen  time.Duration
+		maxOpen  time.Duration
+		counted  bool
+	}{
+		{"idle connection", 100 * time.Millisecond, &http.Server{}, 0, 100 * time.Millisecond, time.Second, true},
+		{"active connection", 100 * time.Millisecond, &http.Server{}, 6, 350 * time.Millisecond, 1500 * time.Millisecond, true},
+		{"server idle timeout first", time.Minute, &http.Server{IdleTimeout: 50 * time.Millisecond, ReadHeaderTimeout: 50 * time.Millisecond}, 1, 50 * time.Millisecond, time.Second, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := serveIdle(t, tt.idle, tt.server)
+			timeouts := metricValue(t, connIdleTimeoutsTotal)
+
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			start := time.Now()
+			br := bufio.NewReader(conn)
+			for i := 0; i < tt.requests; i++ {
+				if i > 0 {
+					time.Sleep(50 * time.Millisecond)
+				}
+				io.WriteString(conn, "GET / HTTP/1.1\r\nHost: test\r\n\r\n")
+				resp, err := http.ReadResponse(br, nil)
+				if err != nil {
+					t.Fatalf("request %d: %v", i+1, err)
+				}
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if _, err := br.ReadByte(); err != io.EOF {
+				t.Fatalf("read on the quiet connection: %v, want EOF", err)
+			}
+			if open := time.Since(start); open < tt.minOpen || open > tt.maxOpen {
+				t.Errorf("connection closed after %s, want between %s and %s", open, tt.minOpen, tt.maxOpen)
+			}
+			// The counter is bumped just before the server closes the connection
+			counted := metricValue(t, connIdleTimeoutsTotal) - timeouts
+			if (counted == 1) != tt.counted || counted > 1 {
+				t.Errorf("conn_idle_timeouts_total grew by %g, want counted %v", counted, tt.counted)
+			}
+		})
+	}
+}
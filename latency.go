@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// Upper bound for the simulated /api latency, well inside the server write timeout
+	maxAPILatency = 5 * time.Second
+
+	// Upper bound for /api?ops=N
+	maxAPIOps = 100
+)
+
+var (
+	// Simulated work time of /api, adjustable at runtime through /admin/latency
+	apiLatency atomic.Int64
+
+	// Per-route latency by path, set through /admin/latency?path=. On /api it
+	// replaces the base latency; other routes are delayed by it before their
+	// handler runs.
+	latencyOverrides sync.Map
+
+	// Routes whose handler simulates its own latency from the override
+	selfTimedPaths = []string{"/api"}
+
+	// Histogram for the simulated work inside handlers, excluding framework overhead
+	handlerWorkDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "handler_work_duration_seconds",
+			Help:    "Time handlers spend on simulated work in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"path"},
+	)
+)
+
+// Record handler work that started at start
+func observeWork(r *http.Request, start time.Time) {
+	handlerWorkDuration.WithLabelValues(r.URL.Path).Observe(secondsSince(start))
+}
+
+// Simulate d of work for the request, returning early if the client goes away
+func simulateWork(r *http.Request, d time.Duration) {
+	defer observeWork(r, time.Now())
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-r.Context().Done():
+	case <-timer.C:
+	}
+}
+
+// Total /api work for ops sub-operations, each drawn independently from the
+// latency distribution, so the sum spreads out like a chain of real calls
+func apiWork(path string, ops int) time.Duration {
+	mean := effectiveAPILatency(path)
+	var total time.Duration
+	for range ops {
+		total += drawLatency(latencyDist, mean)
+	}
+	total += coldStartLatency()
+	return min(total, maxAPILatency)
+}
+
+func init() {
+	apiLatency.Store(int64(10 * time.Millisecond))
+}
+
+// Parse and bounds-check a latency value
+func parseLatency(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	if d < 0 || d > maxAPILatency {
+		return 0, fmt.Errorf("latency must be between 0 and %s", maxAPILatency)
+	}
+	return d, nil
+}
+
+// Latency override for path, if one is set
+func latencyOverride(path string) (time.Duration, bool) {
+	v, ok := latencyOverrides.Load(path)
+	if !ok {
+		return 0, false
+	}
+	return v.(time.Duration), true
+}
+
+// Delay requests to path by its latency override, unless its handler applies
+// the override itself
+func delayed(path string, next http.Handler) http.Handler {
+	if slices.Contains(selfTimedPaths, path) {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d, ok := latencyOverride(path); ok {
+			simulateWork(r, d)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Report (GET) or update (POST/PUT ?value=200ms) the simulated /api latency.
+// With ?path= the value overrides the latency of that route only, and DELETE
+// ?path= removes the override.
+func (rt *router) adminLatencyHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	path := q.Get("path")
+	if path != "" {
+		if _, ok := rt.toggles[path]; !ok {
+			writeJSONError(w, http.StatusNotFound, fmt.Sprintf("no app route %q", path))
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodDelete:
+		if path == "" {
+			writeJSONError(w, http.StatusBadRequest, "path is required")
+			return
+		}
+		latencyOverrides.Delete(path)
+		events.add(eventSettingChanged, "Latency override removed", "path", path)
+	default:
+		d, err := parseLatency(q.Get("value"))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if path == "" {
+			apiLatency.Store(int64(d))
+		} else {
+			latencyOverrides.Store(path, d)
+		}
+		events.add(eventSettingChanged, "Latency changed", "path", path, "latency", d.String())
+	}
+
+	overrides := map[string]string{}
+	latencyOverrides.Range(func(k, v any) bool {
+		overrides[k.(string)] = v.(time.Duration).String()
+		return true
+	})
+	writeJSON(w, http.StatusOK, map[string]any{
+		"latency":   time.Duration(apiLatency.Load()).String(),
+		"overrides": overrides,
+	})
+}
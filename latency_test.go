@@ -0,0 +1,188 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Clear route latency overrides set by a test
+func resetLatencyOverrides(t *testing.T) {
+	t.Cleanup(func() { latencyOverrides.Clear() })
+}
+
+func TestAdminLatencyOverrides(t *testing.T) {
+	resetLatencyOverrides(t)
+	setAtomic(t, &apiLatency, int64(10*time.Millisecond))
+	rt := newTestRouter(t)
+
+	tests := []struct {
+		method, target string
+		status         int
+		override       time.Duration // of /uptime afterwards; 0 for none
+	}{
+		{http.MethodPost, "/admin/latency?path=/uptime&value=20ms", http.StatusOK, 20 * time.Millisecond},
+		{http.MethodGet, "/admin/latency", http.StatusOK, 20 * time.Millisecond},
+		{http.MethodPost, "/admin/latency?path=/uptime&value=never", http.StatusBadRequest, 20 * time.Millisecond},
+		{http.MethodPost, "/admin/latency?path=/nowhere&value=20ms", http.StatusNotFound, 20 * time.Millisecond},
+		{http.MethodPost, "/admin/latency?path=/admin/events&value=20ms", http.StatusNotFound, 20 * time.Millisecond},
+		{http.MethodDelete, "/admin/latency", http.StatusBadRequest, 20 * time.Millisecond},
+		{http.MethodDelete, "/admin/latency?path=/uptime", http.StatusOK, 0},
+	}
+	for _, tt := range tests {
+		rec := serve(rt, tt.method, tt.target)
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: status %d, want %d: %s", tt.method, tt.target, rec.Code, tt.status, rec.Body)
+		}
+		d, _ := latencyOverride("/uptime")
+		if d != tt.override {
+			t.Errorf("after %s %s: /uptime override %s, want %s", tt.method, tt.target, d, tt.override)
+		}
+	}
+	if got := time.Duration(apiLatency.Load()); got != 10*time.Millisecond {
+		t.Errorf("route overrides changed the base latency to %s", got)
+	}
+}
+
+func TestLatencyOverrideDelaysRoute(t *testing.T) {
+	resetLatencyOverrides(t)
+	rt := newTestRouter(t)
+	latencyOverrides.Store("/uptime", 100*time.Millisecond)
+
+	start := time.Now()
+	if rec := serve(rt, http.MethodGet, "/uptime"); rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("overridden route took %s, want at least 100ms", elapsed)
+	}
+}
+
+// Cache hits skip the override like they skip the handler
+func TestLatencyOverrideSkippedOnCacheHit(t *testing.T) {
+	resetLatencyOverrides(t)
+	setVar(t, &cachePaths, []string{"/uptime"})
+	setVar(t, &responseCache, newLRUCache(10, time.Minute))
+	rt := newTestRouter(t)
+	latencyOverrides.Store("/uptime", 100*time.Millisecond)
+
+	if rec := serve(rt, http.MethodGet, "/uptime"); rec.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("first request X-Cache %q, want MISS", rec.Header().Get("X-Cache"))
+	}
+	start := time.Now()
+	rec := serve(rt, http.MethodGet, "/uptime")
+	elapsed := time.Since(start)
+	if rec.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("second request X-Cache %q, want HIT", rec.Header().Get("X-Cache"))
+	}
+	if elapsed >= 50*time.Millisecond {
+		t.Errorf("cache hit took %s, want no override delay", elapsed)
+	}
+}
+
+// Simulated work is recorded apart from the end-to-end duration and never
+// exceeds it
+func TestHandlerWorkDuration(t *testing.T) {
+	resetLatencyOverrides(t)
+	setAtomic(t, &apiLatency, int64(30*time.Millisecond))
+	setVar(t, &burnCoalesce, false)
+	rt := newTestRouter(t)
+
+	tests := []struct {
+		target, path string
+		work         time.Duration
+	}{
+		{"/api", "/api", 30 * time.Millisecond},
+		{"/api?ops=2", "/api", 60 * time.Millisecond},
+		{"/burn?duration=20ms", "/burn", 20 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		work := handlerWorkDuration.WithLabelValues(tt.path).(prometheus.Metric)
+		total := httpRequestDuration.WithLabelValues(tt.path, http.MethodGet).(prometheus.Metric)
+		workCount, workSum := histogramValue(t, work)
+		totalCount, totalSum := histogramValue(t, total)
+
+		if rec := serve(rt, http.MethodGet, tt.target); rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d", tt.target, rec.Code)
+		}
+
+		n, sum := histogramValue(t, work)
+		workCount, gotWork := n-workCount, time.Duration((sum-workSum)*float64(time.Second))
+		n, sum = histogramValue(t, total)
+		totalCount, gotTotal := n-totalCount, time.Duration((sum-totalSum)*float64(time.Second))
+		if workCount != 1 || totalCount != 1 {
+			t.Errorf("%s: %d work and %d total observations, want 1 each", tt.target, workCount, totalCount)
+		}
+		if gotWork < tt.work {
+			t.Errorf("%s: work %s, want at least %s", tt.target, gotWork, tt.work)
+		}
+		if gotWork > gotTotal {
+			t.Errorf("%s: work %s exceeds the total %s", tt.target, gotWork, gotTotal)
+		}
+	}
+}
+
+// /api?ops=N sums N independent draws, so the work scales with N
+func TestAPIWorkOps(t *testing.T) {
+	resetLatencyOverrides(t)
+	setAtomic(t, &apiLatency, int64(10*time.Millisecond))
+	setVar(t, &coldStartPenalty, 0)
+	setAtomic(t, &spikeUntil, 0)
+	setVar(t, &latencyPerQPS, 0)
+
+	tests := []struct {
+		dist     latencyDistConfig
+		ops      int
+		min, max time.Duration
+	}{
+		{latencyDistConfig{kind: latencyFixed}, 1, 10 * time.Millisecond, 10 * time.Millisecond},
+		{latencyDistConfig{kind: latencyFixed}, 7, 70 * time.Millisecond, 70 * time.Millisecond},
+		{latencyDistConfig{kind: latencyFixed}, maxAPIOps, time.Second, time.Second},
+		// Each of the draws stays within 5-15ms
+		{latencyDistConfig{kind: latencyUniform, spread: 5 * time.Millisecond}, 20, 100 * time.Millisecond, 300 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		setVar(t, &latencyDist, tt.dist)
+		seedLatencyRand(1)
+		if got := apiWork("/api", tt.ops); got < tt.min || got > tt.max {
+			t.Errorf("%s, %d ops: work %s, want between %s and %s", tt.dist.kind, tt.ops, got, tt.min, tt.max)
+		}
+	}
+}
+
+// The request takes about the sum of its operations; ops outside 1 to
+// maxAPIOps are rejected
+func TestAPIOpsRequest(t *testing.T) {
+	resetLatencyOverrides(t)
+	setAtomic(t, &apiLatency, int64(20*time.Millisecond))
+	setAtomic(t, &spikeUntil, 0)
+	setVar(t, &latencyPerQPS, 0)
+	setVar(t, &coldStartPenalty, 0)
+	setVar(t, &latencyDist, latencyDistConfig{kind: latencyFixed})
+
+	tests := []struct {
+		target string
+		status int
+		min    time.Duration
+	}{
+		{"/api", http.StatusOK, 20 * time.Millisecond},
+		{"/api?ops=1", http.StatusOK, 20 * time.Millisecond},
+		{"/api?ops=5", http.StatusOK, 100 * time.Millisecond},
+		{"/api?ops=0", http.StatusBadRequest, 0},
+		{"/api?ops=101", http.StatusBadRequest, 0},
+		{"/api?ops=two", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		rec := serve(http.HandlerFunc(apiHandler), http.MethodGet, tt.target)
+		elapsed := time.Since(start)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.target, rec.Code, tt.status)
+		}
+		if elapsed < tt.min || elapsed > tt.min+50*time.Millisecond {
+			t.Errorf("%s: took %s, want about %s", tt.target, elapsed, tt.min)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Latency distributions selectable with LATENCY_DIST. All are centred on the
+// current /api latency so /admin/latency and the schedule keep working.
+const (
+	latencyFixed       = "fixed"
+	latencyUniform     = "uniform"
+	latencyNormal      = "normal"
+	latencyExponential = "exponential"
+)
+
+// Distribution settings for the simulated /api latency
+type latencyDistConfig struct {
+	kind string
+	// Half-width of the uniform distribution around the mean (LATENCY_SPREAD)
+	spread time.Duration
+	// Standard deviation of the normal distribution (LATENCY_STDDEV)
+	stddev time.Duration
+}
+
+var (
+	latencyDist = latencyDistConfig{kind: latencyFixed}
+
+	// Seeded PRNG for latency draws, so runs with the same LATENCY_SEED repeat
+	latencyRandMu sync.Mutex
+	latencyRand   = rand.New(rand.NewPCG(uint64(time.Now().UnixNano()), 0))
+)
+
+func validLatencyDist(kind string) error {
+	switch kind {
+	case latencyFixed, latencyUniform, latencyNormal, latencyExponential:
+		return nil
+	}
+	return fmt.Errorf("unknown distribution %q, want fixed, uniform, normal or exponential", kind)
+}
+
+// Reseed the latency PRNG
+func seedLatencyRand(seed uint64) {
+	latencyRandMu.Lock()
+	latencyRand = rand.New(rand.NewPCG(seed, 0))
+	latencyRandMu.Unlock()
+}
+
+// Draw one request's latency around mean, clamped to [0, maxAPILatency]
+func drawLatency(cfg latencyDistConfig, mean time.Duration) time.Duration {
+	latencyRandMu.Lock()
+	var d float64
+	switch cfg.kind {
+	case latencyUniform:
+		d = float64(mean) + (latencyRand.Float64()*2-1)*float64(cfg.spread)
+	case latencyNormal:
+		d = float64(mean) + latencyRand.NormFloat64()*float64(cfg.stddev)
+	case latencyExponential:
+		d = latencyRand.ExpFloat64() * float64(mean)
+	default:
+		d = float64(mean)
+	}
+	latencyRandMu.Unlock()
+
+	return time.Duration(min(max(d, 0), float64(maxAPILatency)))
+}
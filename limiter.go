@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Gauge for the current adaptive concurrency limit of /api
+	concurrencyLimitGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "concurrency_limit",
+			Help: "Current adaptive concurrency limit for /api",
+		},
+	)
+
+	// Counter for /api requests rejected by the adaptive limit
+	concurrencyLimitedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "concurrency_limited_total",
+			Help: "Total number of /api requests rejected by the adaptive concurrency limit",
+		},
+	)
+
+	// Adaptive concurrency limiter for /api; nil unless ADAPTIVE_LIMIT is set
+	apiLimiter concurrencyLimiter
+)
+
+// Limits concurrent requests, adapting the limit from observed latency
+type concurrencyLimiter interface {
+	// Admit a request, or report false when at the limit
+	acquire() bool
+	// Finish an admitted request that took rtt
+	release(rtt time.Duration, failed bool)
+}
+
+// Settings shared by the adaptive limiters
+type limiterConfig struct {
+	initial, min, max int
+	// AIMD: latency above which the limit backs off
+	latencyThreshold time.Duration
+	// AIMD: factor the limit is multiplied by on backoff
+	backoff float64
+	// Gradient: requests sampled per limit update
+	window int
+}
+
+var defaultLimiterConfig = limiterConfig{
+	initial:          20,
+	min:              1,
+	max:              1000,
+	latencyThreshold: 100 * time.Millisecond,
+	backoff:          0.9,
+	window:           50,
+}
+
+// Build the limiter named by ADAPTIVE_LIMIT; empty disables limiting
+func newConcurrencyLimiter(kind string, cfg limiterConfig) (concurrencyLimiter, error) {
+	if kind == "" {
+		return nil, nil
+	}
+	if cfg.min < 1 || cfg.max < cfg.min || cfg.initial < cfg.min || cfg.initial > cfg.max {
+		return nil, fmt.Errorf("need 1 <= min <= initial <= max")
+	}
+	switch kind {
+	case "aimd":
+		if cfg.latencyThreshold <= 0 || cfg.backoff <= 0 || cfg.backoff >= 1 {
+			return nil, fmt.Errorf("aimd needs a positive latency threshold and a backoff in (0,1)")
+		}
+		return newAIMDLimiter(cfg), nil
+	case "gradient":
+		if cfg.window < 1 {
+			return nil, fmt.Errorf("gradient needs a positive sample window")
+		}
+		return newGradientLimiter(cfg), nil
+	}
+	return nil, fmt.Errorf("unknown limiter %q, want aimd or gradient", kind)
+}
+
+// Additive-increase/multiplicative-decrease limiter: every healthy request
+// grows the limit by 1/limit, about +1 per limit's worth of requests, and a
+// slow or failed one multiplies it by the backoff factor
+type aimdLimiter struct {
+	cfg limiterConfig
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+}
+
+func newAIMDLimiter(cfg limiterConfig) *aimdLimiter {
+	l := &aimdLimiter{cfg: cfg, limit: float64(cfg.initial)}
+	concurrencyLimitGauge.Set(float64(cfg.initial))
+	return l
+}
+
+func (l *aimdLimiter) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight >= int(l.limit) {
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+func (l *aimdLimiter) release(rtt time.Duration, failed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	if failed || rtt > l.cfg.latencyThreshold {
+		l.limit = max(l.limit*l.cfg.backoff, float64(l.cfg.min))
+	} else {
+		l.limit = min(l.limit+1/l.limit, float64(l.cfg.max))
+	}
+	concurrencyLimitGauge.Set(float64(int(l.limit)))
+}
+
+// Gradient limiter in the style of Netflix's gradient2: every window of
+// requests it compares their median latency with a slowly moving baseline.
+// While latency stays at the baseline the limit grows by its square root, the
+// headroom for queueing; as latency rises the limit shrinks in proportion,
+// down to half per update.
+type gradientLimiter struct {
+	cfg limiterConfig
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	samples  []time.Duration
+	// Long-term median latency; zero until the first window completes
+	baseline time.Duration
+}
+
+// Smoothing of limit and baseline updates
+const (
+	gradientLimitSmoothing    = 0.2
+	gradientBaselineSmoothing = 0.05
+)
+
+func newGradientLimiter(cfg limiterConfig) *gradientLimiter {
+	l := &gradientLimiter{cfg: cfg, limit: float64(cfg.initial), samples: make([]time.Duration, 0, cfg.window)}
+	concurrencyLimitGauge.Set(float64(cfg.initial))
+	return l
+}
+
+func (l *gradientLimiter) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight >= int(l.limit) {
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+func (l *gradientLimiter) release(rtt time.Duration, failed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	// Failures are often fast and would drag the median down
+	if failed {
+		return
+	}
+	l.samples = append(l.samples, rtt)
+	if len(l.samples) < l.cfg.window {
+		return
+	}
+
+	slices.Sort(l.samples)
+	p50 := l.samples[len(l.samples)/2]
+	l.samples = l.samples[:0]
+
+	// The baseline follows the median slowly upwards but drops at once to a
+	// faster one, so a long overload cannot become the new normal
+	if l.baseline == 0 || p50 < l.baseline {
+		l.baseline = p50
+	} else {
+		l.baseline += time.Duration(gradientBaselineSmoothing * float64(p50-l.baseline))
+	}
+
+	gradient := 1.0
+	if p50 > 0 {
+		gradient = max(0.5, min(1, float64(l.baseline)/float64(p50)))
+	}
+	target := l.limit*gradient + math.Sqrt(l.limit)
+	l.limit += gradientLimitSmoothing * (target - l.limit)
+	l.limit = max(float64(l.cfg.min), min(l.limit, float64(l.cfg.max)))
+	concurrencyLimitGauge.Set(float64(int(l.limit)))
+}
+
+// Admit requests through apiLimiter, rejecting with 503 at the limit
+func limited(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := apiLimiter
+		if l == nil {
+			next(w, r)
+			return
+		}
+		if !l.acquire() {
+			concurrencyLimitedTotal.Inc()
+			writeUnavailable(w, "concurrency_limited", "concurrency limit reached")
+			return
+		}
+
+		start := time.Now()
+		rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next(rw, r)
+		l.release(time.Since(start), rw.statusCode >= 500)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewConcurrencyLimiter(t *testing.T) {
+	tests := []struct {
+		name string
+		kind string
+		cfg  func(*limiterConfig)
+		ok   bool
+	}{
+		{"disabled", "", nil, true},
+		{"aimd", "aimd", nil, true},
+		{"gradient", "gradient", nil, true},
+		{"unknown", "vegas", nil, false},
+		{"min above max", "aimd", func(c *limiterConfig) { c.min, c.max = 10, 5 }, false},
+		{"initial below min", "aimd", func(c *limiterConfig) { c.initial, c.min = 1, 2 }, false},
+		{"backoff of one", "aimd", func(c *limiterConfig) { c.backoff = 1 }, false},
+		{"no threshold", "aimd", func(c *limiterConfig) { c.latencyThreshold = 0 }, false},
+		{"empty window", "gradient", func(c *limiterConfig) { c.window = 0 }, false},
+	}
+	for _, tt := range tests {
+		cfg := defaultLimiterConfig
+		if tt.cfg != nil {
+			tt.cfg(&cfg)
+		}
+		_, err := newConcurrencyLimiter(tt.kind, cfg)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: error %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+// Healthy requests grow the AIMD limit by about one per limit's worth of
+// requests; slow or failed ones back it off
+func TestAIMDLimiter(t *testing.T) {
+	cfg := limiterConfig{initial: 10, min: 2, max: 12, latencyThreshold: 100 * time.Millisecond, backoff: 0.5}
+
+	tests := []struct {
+		name     string
+		requests int
+		rtt      time.Duration
+		failed   bool
+		limit    int // after the requests, starting from 10
+	}{
+		{"healthy", 10, 10 * time.Millisecond, false, 10},
+		{"healthy long enough to grow", 11, 10 * time.Millisecond, false, 11},
+		{"capped at max", 100, 10 * time.Millisecond, false, 12},
+		{"one slow request", 1, 200 * time.Millisecond, false, 5},
+		{"rising latency", 3, 200 * time.Millisecond, false, 2}, // 10 -> 5 -> 2.5 -> floored at min
+		{"one failure", 1, 10 * time.Millisecond, true, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newAIMDLimiter(cfg)
+			for i := 0; i < tt.requests; i++ {
+				if !l.acquire() {
+					t.Fatalf("request %d rejected", i+1)
+				}
+				l.release(tt.rtt, tt.failed)
+			}
+			if got := int(l.limit); got != tt.limit {
+				t.Errorf("limit %d, want %d", got, tt.limit)
+			}
+			if got := metricValue(t, concurrencyLimitGauge); got != float64(tt.limit) {
+				t.Errorf("concurrency_limit %g, want %d", got, tt.limit)
+			}
+		})
+	}
+}
+
+// Requests past the limit get a 503 until an admitted one finishes
+func TestLimited(t *testing.T) {
+	l := newAIMDLimiter(limiterConfig{initial: 2, min: 1, max: 2, latencyThreshold: time.Minute, backoff: 0.5})
+	setVar(t, &apiLimiter, concurrencyLimiter(l))
+
+	release := make(chan struct{})
+	h := limited(func(w http.ResponseWriter, r *http.Request) { <-release })
+	done := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() { done <- serve(h, http.MethodGet, "/api").Code }()
+	}
+	// Wait until both requests hold their slot
+	for deadline := time.Now().Add(time.Second); ; {
+		l.mu.Lock()
+		n := l.inFlight
+		l.mu.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d requests admitted, want 2", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	rejected := metricValue(t, concurrencyLimitedTotal)
+	if rec := serve(h, http.MethodGet, "/api"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("request over the limit: status %d, want 503", rec.Code)
+	}
+	if got := metricValue(t, concurrencyLimitedTotal) - rejected; got != 1 {
+		t.Errorf("concurrency_limited_total grew by %g, want 1", got)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if code := <-done; code != http.StatusOK {
+			t.Errorf("admitted request: status %d, want 200", code)
+		}
+	}
+	if rec := serve(h, http.MethodGet, "/api"); rec.Code != http.StatusOK {
+		t.Errorf("request after the others finished: status %d, want 200", rec.Code)
+	}
+}
+
+// The gradient limit grows while the window median stays at the baseline and
+// shrinks as it rises above it
+func TestGradientLimiter(t *testing.T) {
+	cfg := limiterConfig{initial: 10, min: 2, max: 100, window: 4}
+	type phase struct {
+		requests int
+		rtt      time.Duration
+		failed   bool
+		want     string // "grow", "shrink" or "same" over the phase
+	}
+	tests := []struct {
+		name   string
+		phases []phase
+	}{
+		{"partial window", []phase{{3, 10 * time.Millisecond, false, "same"}}},
+		{"steady latency", []phase{{4, 10 * time.Millisecond, false, "grow"}, {40, 10 * time.Millisecond, false, "grow"}}},
+		{"rising latency", []phase{{4, 10 * time.Millisecond, false, "grow"}, {4, 40 * time.Millisecond, false, "shrink"}, {40, 80 * time.Millisecond, false, "shrink"}}},
+		// Fast failures would pull the median below the baseline
+		{"failures ignored", []phase{{40, time.Millisecond, true, "same"}}},
+		{"latency recovers", []phase{{4, 10 * time.Millisecond, false, "grow"}, {8, 80 * time.Millisecond, false, "shrink"}, {8, 5 * time.Millisecond, false, "grow"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newGradientLimiter(cfg)
+			for i, p := range tt.phases {
+				before := l.limit
+				for j := 0; j < p.requests; j++ {
+					if !l.acquire() {
+						t.Fatalf("phase %d: request %d rejected", i+1, j+1)
+					}
+					l.release(p.rtt, p.failed)
+				}
+				got := "same"
+				if l.limit > before {
+					got = "grow"
+				} else if l.limit < before {
+					got = "shrink"
+				}
+				if got != p.want {
+					t.Errorf("phase %d: limit %.2f -> %.2f, want %s", i+1, before, l.limit, p.want)
+				}
+				if l.limit < float64(cfg.min) || l.limit > float64(cfg.max) {
+					t.Errorf("phase %d: limit %.2f outside [%d, %d]", i+1, l.limit, cfg.min, cfg.max)
+				}
+			}
+			if got := metricValue(t, concurrencyLimitGauge); got != float64(int(l.limit)) {
+				t.Errorf("concurrency_limit %g, want %d", got, int(l.limit))
+			}
+		})
+	}
+}
+
+// The limit stays within its bounds while latency is steady or bad; ten
+// windows are short enough for the baseline not to catch up with bad latency
+func TestGradientLimiterBounds(t *testing.T) {
+	cfg := limiterConfig{initial: 10, min: 8, max: 12, window: 2}
+	tests := []struct {
+		name  string
+		rtts  []time.Duration
+		limit int
+	}{
+		{"capped at max", []time.Duration{10 * time.Millisecond}, 12},
+		{"floored at min", []time.Duration{10 * time.Millisecond, time.Second}, 8},
+	}
+	for _, tt := range tests {
+		l := newGradientLimiter(cfg)
+		for _, rtt := range tt.rtts {
+			for i := 0; i < 10*cfg.window; i++ {
+				l.acquire()
+				l.release(rtt, false)
+			}
+		}
+		if got := int(l.limit); got != tt.limit {
+			t.Errorf("%s: limit %d, want %d", tt.name, got, tt.limit)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Root of the cgroup filesystem; the process's own cgroup is mounted here in
+// a container. Tests point it at a fake tree.
+var cgroupRoot = "/sys/fs/cgroup"
+
+// Read a cgroup file, trimmed
+func readCgroupFile(name string) (string, error) {
+	b, err := os.ReadFile(filepath.Join(cgroupRoot, name))
+	return strings.TrimSpace(string(b)), err
+}
+
+// Limits and usage that bound how far one pod can scale. Limits are nil
+// when unlimited or unknown; errors explain the unknown ones.
+type resourceLimits struct {
+	OpenFiles struct {
+		Soft *uint64 `json:"soft"`
+		Hard *uint64 `json:"hard"`
+		Open int     `json:"open"`
+	} `json:"open_files"`
+	Memory struct {
+		LimitBytes *uint64 `json:"limit_bytes"`
+		UsageBytes *uint64 `json:"usage_bytes"`
+	} `json:"memory"`
+	CPU struct {
+		LimitCores *float64 `json:"limit_cores"`
+		UsageSec   *float64 `json:"usage_seconds"`
+		NumCPU     int      `json:"num_cpu"`
+		GOMAXPROCS int      `json:"gomaxprocs"`
+	} `json:"cpu"`
+	CgroupVersion int               `json:"cgroup_version,omitempty"`
+	Errors        map[string]string `json:"errors,omitempty"`
+}
+
+// Parse a cgroup limit, where "max" (v2) or a huge value (v1) means unlimited
+func parseCgroupLimit(value string) (*uint64, error) {
+	if value == "max" {
+		return nil, nil
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parse %q: %w", value, err)
+	}
+	// cgroup v1 reports "no limit" as the largest page-aligned int64
+	if n >= math.MaxInt64&^4095 {
+		return nil, nil
+	}
+	return &n, nil
+}
+
+// Parse a CPU quota and period in microseconds into cores; a quota of "max"
+// (v2) or -1 (v1) means unlimited
+func parseCPUQuota(quota, period string) (*float64, error) {
+	if quota == "max" || quota == "-1" {
+		return nil, nil
+	}
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parse quota %q: %w", quota, err)
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return nil, fmt.Errorf("parse period %q", period)
+	}
+	cores := q / p
+	return &cores, nil
+}
+
+// Fill in the cgroup limits and usage, preferring cgroup v2 and falling back
+// to the v1 hierarchy
+func (l *resourceLimits) readCgroup() {
+	if memMax, err := readCgroupFile("memory.max"); err == nil {
+		l.CgroupVersion = 2
+		l.Memory.LimitBytes, err = parseCgroupLimit(memMax)
+		l.note("memory.limit", err)
+		l.Memory.UsageBytes = l.readUint("memory.usage", "memory.current")
+
+		if cpuMax, err := readCgroupFile("cpu.max"); err != nil {
+			l.note("cpu.limit", err)
+		} else {
+			quota, period, _ := strings.Cut(cpuMax, " ")
+			l.CPU.LimitCores, err = parseCPUQuota(quota, period)
+			l.note("cpu.limit", err)
+		}
+		if stat, err := readCgroupFile("cpu.stat"); err != nil {
+			l.note("cpu.usage", err)
+		} else {
+			for _, line := range strings.Split(stat, "\n") {
+				if v, ok := strings.CutPrefix(line, "usage_usec "); ok {
+					if usec, err := strconv.ParseFloat(v, 64); err == nil {
+						sec := usec / 1e6
+						l.CPU.UsageSec = &sec
+					}
+				}
+			}
+		}
+		return
+	}
+
+	memLimit, err := readCgroupFile("memory/memory.limit_in_bytes")
+	if err != nil {
+		l.note("cgroup", fmt.Errorf("no cgroup v2 or v1 memory controller under %s", cgroupRoot))
+		return
+	}
+	l.CgroupVersion = 1
+	l.Memory.LimitBytes, err = parseCgroupLimit(memLimit)
+	l.note("memory.limit", err)
+	l.Memory.UsageBytes = l.readUint("memory.usage", "memory/memory.usage_in_bytes")
+
+	quota, err := readCgroupFile("cpu/cpu.cfs_quota_us")
+	l.note("cpu.limit", err)
+	period, err := readCgroupFile("cpu/cpu.cfs_period_us")
+	l.note("cpu.limit", err)
+	if quota != "" && period != "" {
+		l.CPU.LimitCores, err = parseCPUQuota(quota, period)
+		l.note("cpu.limit", err)
+	}
+	if ns := l.readUint("cpu.usage", "cpuacct/cpuacct.usage"); ns != nil {
+		sec := float64(*ns) / 1e9
+		l.CPU.UsageSec = &sec
+	}
+}
+
+// Read a cgroup counter, noting any error under key
+func (l *resourceLimits) readUint(key, name string) *uint64 {
+	v, err := readCgroupFile(name)
+	if err != nil {
+		l.note(key, err)
+		return nil
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		l.note(key, fmt.Errorf("parse %s: %w", name, err))
+		return nil
+	}
+	return &n
+}
+
+func (l *resourceLimits) note(key string, err error) {
+	if err == nil {
+		return
+	}
+	if l.Errors == nil {
+		l.Errors = map[string]string{}
+	}
+	l.Errors[key] = err.Error()
+}
+
+// Report the open-file, memory and CPU limits with current usage, to explain
+// why a pod stops scaling before its replicas do
+func adminLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	var l resourceLimits
+	soft, hard, err := openFileLimit()
+	if err != nil {
+		l.note("open_files.limit", err)
+	} else {
+		l.OpenFiles.Soft, l.OpenFiles.Hard = soft, hard
+	}
+	if fds, err := os.ReadDir("/proc/self/fd"); err != nil {
+		l.note("open_files.open", err)
+	} else {
+		l.OpenFiles.Open = len(fds)
+	}
+	l.CPU.NumCPU = runtime.NumCPU()
+	l.CPU.GOMAXPROCS = runtime.GOMAXPROCS(0)
+	l.readCgroup()
+
+	writeJSON(w, http.StatusOK, l)
+}
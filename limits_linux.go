@@ -0,0 +1,21 @@
+//go:build linux
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// Soft and hard RLIMIT_NOFILE; nil means unlimited
+func openFileLimit() (soft, hard *uint64, err error) {
+	var rl unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &rl); err != nil {
+		return nil, nil, err
+	}
+	return rlimitValue(rl.Cur), rlimitValue(rl.Max), nil
+}
+
+func rlimitValue(v uint64) *uint64 {
+	if v == unix.RLIM_INFINITY {
+		return nil
+	}
+	return &v
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// File limits are only read on Linux, where the pods run
+func openFileLimit() (soft, hard *uint64, err error) {
+	return nil, nil, errors.New("open-file limits are only read on Linux")
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// Point cgroupRoot at a fake tree holding files
+func fakeCgroup(t *testing.T, files map[string]string) {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setVar(t, &cgroupRoot, root)
+}
+
+// Pointer to a copy of v
+func ptr[T any](v T) *T { return &v }
+
+// The parsed cgroup fields of a /admin/limits response
+type cgroupLimits struct {
+	version   int
+	memLimit  *uint64
+	memUsage  *uint64
+	cpuLimit  *float64
+	cpuUsage  *float64
+	errorKeys []string
+}
+
+// Readable form, dereferencing the pointers
+func (l cgroupLimits) String() string {
+	deref := func(p any) any {
+		if v := reflect.ValueOf(p); !v.IsNil() {
+			return v.Elem().Interface()
+		}
+		return nil
+	}
+	b, _ := json.Marshal([]any{l.version, deref(l.memLimit), deref(l.memUsage), deref(l.cpuLimit), deref(l.cpuUsage), l.errorKeys})
+	return string(b)
+}
+
+// The endpoint reports parsed numbers from either cgroup version, nil for
+// unlimited, and an error for what it could not read
+func TestAdminLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  cgroupLimits
+	}{
+		{"v2 limited", map[string]string{
+			"memory.max":     "536870912",
+			"memory.current": "104857600",
+			"cpu.max":        "150000 100000",
+			"cpu.stat":       "usage_usec 2500000\nuser_usec 2000000",
+		}, cgroupLimits{2, ptr[uint64](536870912), ptr[uint64](104857600), ptr(1.5), ptr(2.5), nil}},
+		{"v2 unlimited", map[string]string{
+			"memory.max":     "max",
+			"memory.current": "4096",
+			"cpu.max":        "max 100000",
+			"cpu.stat":       "usage_usec 1000",
+		}, cgroupLimits{2, nil, ptr[uint64](4096), nil, ptr(0.001), nil}},
+		{"v2 unreadable", map[string]string{
+			"memory.max":     "lots",
+			"memory.current": "-1",
+		}, cgroupLimits{2, nil, nil, nil, nil, []string{"cpu.limit", "cpu.usage", "memory.limit", "memory.usage"}}},
+		{"v1 limited", map[string]string{
+			"memory/memory.limit_in_bytes": "268435456",
+			"memory/memory.usage_in_bytes": "1048576",
+			"cpu/cpu.cfs_quota_us":         "50000",
+			"cpu/cpu.cfs_period_us":        "100000",
+			"cpuacct/cpuacct.usage":        "3000000000",
+		}, cgroupLimits{1, ptr[uint64](268435456), ptr[uint64](1048576), ptr(0.5), ptr(3.0), nil}},
+		{"v1 unlimited", map[string]string{
+			"memory/memory.limit_in_bytes": "9223372036854771712",
+			"memory/memory.usage_in_bytes": "1048576",
+			"cpu/cpu.cfs_quota_us":         "-1",
+			"cpu/cpu.cfs_period_us":        "100000",
+			"cpuacct/cpuacct.usage":        "0",
+		}, cgroupLimits{1, nil, ptr[uint64](1048576), nil, ptr(0.0), nil}},
+		{"no cgroup", nil, cgroupLimits{0, nil, nil, nil, nil, []string{"cgroup"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeCgroup(t, tt.files)
+			rec := serve(http.HandlerFunc(adminLimitsHandler), http.MethodGet, "/admin/limits")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d, want 200", rec.Code)
+			}
+			var l resourceLimits
+			if err := json.Unmarshal(rec.Body.Bytes(), &l); err != nil {
+				t.Fatalf("body is not JSON: %v\n%s", err, rec.Body)
+			}
+
+			var errorKeys []string
+			for _, key := range []string{"cgroup", "cpu.limit", "cpu.usage", "memory.limit", "memory.usage"} {
+				if _, ok := l.Errors[key]; ok {
+					errorKeys = append(errorKeys, key)
+				}
+			}
+			got := cgroupLimits{l.CgroupVersion, l.Memory.LimitBytes, l.Memory.UsageBytes, l.CPU.LimitCores, l.CPU.UsageSec, errorKeys}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("limits %s, want %s\n%s", got, tt.want, rec.Body)
+			}
+
+			if l.CPU.NumCPU != runtime.NumCPU() || l.CPU.GOMAXPROCS != runtime.GOMAXPROCS(0) {
+				t.Errorf("num_cpu %d gomaxprocs %d", l.CPU.NumCPU, l.CPU.GOMAXPROCS)
+			}
+			if runtime.GOOS == "linux" && (l.OpenFiles.Open == 0 || l.OpenFiles.Hard != nil && l.OpenFiles.Soft == nil) {
+				t.Errorf("open files %d of soft %v hard %v", l.OpenFiles.Open, l.OpenFiles.Soft, l.OpenFiles.Hard)
+			}
+		})
+	}
+}
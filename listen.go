@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// stringList is a flag.Value that accepts repeated and comma-separated values
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		*s = append(*s, strings.TrimSpace(v))
+	}
+	return nil
+}
+
+// Network for listeners, from LISTEN_NETWORK: tcp (dual-stack where
+// available), tcp4 or tcp6
+var listenNetwork = "tcp"
+
+func validListenNetwork(network string) error {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		return nil
+	}
+	return fmt.Errorf("unknown network %q, want tcp, tcp4 or tcp6", network)
+}
+
+// Socket options applied to every listener
+type listenOptions struct {
+	// Set SO_REUSEPORT so several processes can share the port, from -reuse-port
+	reusePort bool
+	// Accept backlog, from -listen-backlog; 0 keeps the system maximum
+	backlog int
+}
+
+// Describe the applied options for the startup log
+func (o listenOptions) String() string {
+	backlog := "system default"
+	if o.backlog > 0 {
+		backlog = strconv.Itoa(o.backlog)
+	}
+	return fmt.Sprintf("reuseport=%t, backlog=%s", o.reusePort, backlog)
+}
+
+// Open one listener per bind address; an empty address means all interfaces.
+// If any listener fails the ones already opened are closed.
+func listenAll(network string, addrs []string, port string, opts listenOptions) ([]net.Listener, error) {
+	if len(addrs) == 0 {
+		addrs = []string{""}
+	}
+
+	var lc net.ListenConfig
+	if opts.reusePort {
+		lc.Control = func(network, address string, c syscall.RawConn) error {
+			return setReusePort(c)
+		}
+	}
+
+	listeners := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		ln, err := listen(lc, network, net.JoinHostPort(addr, port), opts.backlog)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("listen on %q: %w", addr, err)
+		}
+		log.Printf("Listening on %s (%s, %s, %s)", ln.Addr(), network, addressFamily(network, ln.Addr()), opts)
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
+
+// Listen on address, then apply the backlog if one is set
+func listen(lc net.ListenConfig, network, address string, backlog int) (net.Listener, error) {
+	ln, err := lc.Listen(context.Background(), network, address)
+	if err != nil || backlog <= 0 {
+		return ln, err
+	}
+	raw, err := ln.(*net.TCPListener).SyscallConn()
+	if err == nil {
+		err = setListenBacklog(raw, backlog)
+	}
+	if err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("set backlog %d: %w", backlog, err)
+	}
+	return ln, nil
+}
+
+// Address family a listener ended up on; an unspecified IPv6 address on
+// the tcp network also accepts IPv4 where the OS allows it, while tcp6
+// listeners are IPv6 only
+func addressFamily(network string, addr net.Addr) string {
+	tcp, ok := addr.(*net.TCPAddr)
+	switch {
+	case !ok:
+		return "unknown"
+	case tcp.IP.To4() != nil:
+		return "IPv4"
+	case tcp.IP.IsUnspecified() && network == "tcp":
+		return "IPv6, dual-stack if supported"
+	}
+	return "IPv6"
+}
+
+// Accept a PROXY protocol (v1 or v2) header on every listener so RemoteAddr
+// is the client behind an L4 load balancer. Connections without a header are
+// still accepted with their own address.
+func withProxyProtocol(listeners []net.Listener) []net.Listener {
+	wrapped := make([]net.Listener, len(listeners))
+	for i, ln := range listeners {
+		wrapped[i] = &proxyproto.Listener{Listener: ln, ReadHeaderTimeout: 10 * time.Second}
+	}
+	return wrapped
+}
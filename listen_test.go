@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"runtime"
+	"testing"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// Bind the listeners and serve a request on each
+func TestListenAllServes(t *testing.T) {
+	tests := []struct {
+		name    string
+		network string
+		addrs   []string
+		opts    listenOptions
+		linux   bool
+	}{
+		{"loopback", "tcp", []string{"127.0.0.1"}, listenOptions{}, false},
+		{"ipv4 only", "tcp4", []string{"127.0.0.1"}, listenOptions{}, false},
+		{"ipv6 only", "tcp6", []string{"::1"}, listenOptions{}, false},
+		{"several addresses", "tcp", []string{"127.0.0.1", "::1"}, listenOptions{}, false},
+		{"socket options", "tcp", []string{"127.0.0.1"}, listenOptions{reusePort: true, backlog: 16}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.linux && runtime.GOOS != "linux" {
+				t.Skip("socket options are Linux only")
+			}
+			listeners, err := listenAll(tt.network, tt.addrs, "0", tt.opts)
+			if err != nil {
+				if ip := net.ParseIP(tt.addrs[len(tt.addrs)-1]); ip.To4() == nil {
+					t.Skipf("no IPv6 loopback: %v", err)
+				}
+				t.Fatalf("listen: %v", err)
+			}
+			if len(listeners) != len(tt.addrs) {
+				t.Fatalf("got %d listeners, want %d", len(listeners), len(tt.addrs))
+			}
+
+			server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "OK")
+			})}
+			defer server.Close()
+			for _, ln := range listeners {
+				go server.Serve(ln)
+			}
+
+			for _, ln := range listeners {
+				resp, err := http.Get("http://" + ln.Addr().String() + "/")
+				if err != nil {
+					t.Fatalf("GET via %s: %v", ln.Addr(), err)
+				}
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK || string(body) != "OK" {
+					t.Errorf("GET via %s: %d %q", ln.Addr(), resp.StatusCode, body)
+				}
+			}
+		})
+	}
+}
+
+// A bad address fails startup and releases the listeners already opened
+func TestListenAllClosesOnError(t *testing.T) {
+	probe, err := net.Listen("tcp4", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("127.0.0.2 not available: %v", err)
+	}
+	probe.Close()
+
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	// 127.0.0.2 takes the port first, then the busy 127.0.0.1 fails
+	addrs := []string{"127.0.0.2", "127.0.0.1"}
+	if _, err := listenAll("tcp4", addrs, port, listenOptions{}); err == nil {
+		t.Fatal("listen on a busy port succeeded")
+	}
+	again, err := net.Listen("tcp4", net.JoinHostPort("127.0.0.2", port))
+	if err != nil {
+		t.Fatalf("first listener was not closed: %v", err)
+	}
+	again.Close()
+}
+
+func TestStringList(t *testing.T) {
+	var s stringList
+	s.Set("127.0.0.1, ::1")
+	s.Set("10.0.0.1")
+	if got, want := s.String(), "127.0.0.1,::1,10.0.0.1"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+// A PROXY header sets RemoteAddr, and so the client IP, to the client behind
+// the load balancer; connections without one keep their own address
+func TestProxyProtocol(t *testing.T) {
+	listeners, err := listenAll("tcp", []string{"127.0.0.1"}, "0", listenOptions{})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ln := withProxyProtocol(listeners)[0]
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, clientIP(r))
+	})}
+	t.Cleanup(func() { server.Close() })
+	go server.Serve(ln)
+
+	client := &net.TCPAddr{IP: net.ParseIP("203.0.113.9"), Port: 41000}
+	tests := []struct {
+		name    string
+		version byte // 0 sends no header
+		ip      string
+	}{
+		{"v1 header", 1, "203.0.113.9"},
+		{"v2 header", 2, "203.0.113.9"},
+		{"no header", 0, "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if tt.version != 0 {
+			header := proxyproto.HeaderProxyFromAddrs(tt.version, client, ln.Addr())
+			if _, err := header.WriteTo(conn); err != nil {
+				t.Fatalf("%s: write header: %v", tt.name, err)
+			}
+		}
+		io.WriteString(conn, "GET / HTTP/1.1\r\nHost: test\r\nConnection: close\r\n\r\n")
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatalf("%s: read response: %v", tt.name, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != tt.ip {
+			t.Errorf("%s: client IP %q, want %q", tt.name, body, tt.ip)
+		}
+	}
+}
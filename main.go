@@ -2,40 +2,81 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var (
 	// Counter for total requests
-	httpRequestsTotal = promauto.NewCounterVec(
+	httpRequestsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "http_requests_total",
-			Help: "Total number of HTTP requests",
+			Help: "Total number of HTTP requests, by ?cohort= tag",
 		},
-		[]string{"path", "method", "status"},
+		[]string{"path", "method", "status", "cohort"},
 	)
 
 	// Gauge for current QPS
-	currentQPS = promauto.NewGauge(
+	currentQPS = prometheus.NewGauge(
 		prometheus.GaugeOpts{
 			Name: "http_requests_per_second",
 			Help: "Current queries per second",
 		},
 	)
 
+	// Exponentially smoothed QPS, less noisy than the per-second gauge
+	smoothedQPS = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "http_requests_per_second_smoothed",
+			Help: "Exponentially weighted moving average of queries per second",
+		},
+	)
+
+	// Gauge for the per-second change in goroutine count
+	goroutineChurn = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "goroutine_churn_per_second",
+			Help: "Absolute change in the number of goroutines over the last second",
+		},
+	)
+
+	// Gauge for requests currently being handled
+	httpRequestsInFlight = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of HTTP requests currently being handled",
+		},
+	)
+
+	// Histogram for inbound request body sizes
+	httpRequestSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_request_size_bytes",
+			Help:    "HTTP request body size in bytes",
+			Buckets: prometheus.ExponentialBuckets(64, 4, 9),
+		},
+		[]string{"path", "method"},
+	)
+
 	// Histogram for request duration
-	httpRequestDuration = promauto.NewHistogramVec(
+	httpRequestDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "http_request_duration_seconds",
 			Help:    "HTTP request duration in seconds",
@@ -44,136 +85,658 @@ var (
 		[]string{"path", "method"},
 	)
 
+	// Histogram for the time until the response status was written, which
+	// for streaming responses comes well before the end of the request
+	httpTimeToFirstByte = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_time_to_first_byte_seconds",
+			Help:    "Time from the start of the request until the handler wrote the response status",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"path", "method"},
+	)
+
 	// Request counter for QPS calculation
 	requestCounter uint64
+
+	// Successful non-probe requests, gating readiness during warmup
+	warmupCounter uint64
+
+	// Readiness flag, true once the server is serving and false while shutting down
+	ready atomic.Bool
+
+	// Set when shutdown is triggered; readiness fails from then on while
+	// requests are still served through the grace delay
+	shuttingDown atomic.Bool
+
+	// Set once the grace delay is over and in-flight requests are being drained
+	draining atomic.Bool
+
+	// Requests currently inside metricsMiddleware, backing http_requests_in_flight
+	inFlight atomic.Int64
 )
 
-// QPS calculator runs in background
+// Weight of the newest per-second sample in smoothedQPS, roughly a 10s average
+const qpsSmoothing = 0.1
+
+// Cumulative counts sampled once a second for the windowed rates
+type qpsSample struct {
+	total, errors, costMilli uint64
+	durations                histogramBuckets
+}
+
+// Rates over the last qpsWindow seconds, updated once per tick
+type qpsCalculator struct {
+	// Ring of samples, one per tick, starting from the counts at creation
+	samples  []qpsSample
+	smoothed float64
+	// Goroutines that start and exit within one tick are invisible to this
+	// sample; it catches sustained swings rather than every spawn
+	lastGoroutines int
+	// Histogram the windowed latency p95 is computed from
+	durations prometheus.Collector
+}
+
+func newQPSCalculator(durations prometheus.Collector) *qpsCalculator {
+	c := &qpsCalculator{lastGoroutines: runtime.NumGoroutine(), durations: durations}
+	c.samples = []qpsSample{c.sample()}
+	return c
+}
+
+func (c *qpsCalculator) sample() qpsSample {
+	return qpsSample{
+		total:     atomic.LoadUint64(&requestCounter),
+		errors:    atomic.LoadUint64(&errorCounter),
+		costMilli: costCounter.Load(),
+		durations: collectBuckets(c.durations),
+	}
+}
+
+// Take the next sample and update the rate gauges from the window
+func (c *qpsCalculator) tick() {
+	// Trimming to the window on every tick applies window changes on the
+	// calculating goroutine, keeping the newest samples
+	window := int(qpsWindow.Load())
+	c.samples = append(c.samples, c.sample())
+	if len(c.samples) > window+1 {
+		c.samples = c.samples[len(c.samples)-window-1:]
+	}
+
+	oldest, newest := c.samples[0], c.samples[len(c.samples)-1]
+	seconds := float64(len(c.samples) - 1)
+	total := newest.total - oldest.total
+	qps := float64(total) / seconds
+	currentQPS.Set(qps)
+	requestCostPerSecond.Set(float64(newest.costMilli-oldest.costMilli) / 1000 / seconds)
+	latencyP95.Store(math.Float64bits(newest.durations.since(oldest.durations).quantile(0.95)))
+	updateRecommendation(qps)
+	lastQPS.Store(int64(math.Round(qps)))
+	c.smoothed += qpsSmoothing * (qps - c.smoothed)
+	smoothedQPS.Set(c.smoothed)
+	if total > 0 {
+		httpErrorRate.Set(float64(newest.errors-oldest.errors) / float64(total))
+	} else {
+		httpErrorRate.Set(0)
+	}
+
+	goroutines := runtime.NumGoroutine()
+	goroutineChurn.Set(math.Abs(float64(goroutines - c.lastGoroutines)))
+	c.lastGoroutines = goroutines
+}
+
+// QPS calculator runs in background, averaging over the last qpsWindow seconds
 func calculateQPS(ctx context.Context) {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
-	var lastCount uint64
+	c := newQPSCalculator(httpRequestDuration)
+	hb := newHeartbeat("qps", time.Second)
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			current := atomic.LoadUint64(&requestCounter)
-			qps := float64(current - lastCount)
-			currentQPS.Set(qps)
-			lastCount = current
+			hb.beat()
+			c.tick()
 		}
 	}
 }
 
+// Elapsed seconds since start at full nanosecond resolution, so near-instant
+// requests observe their sub-microsecond duration rather than a rounded zero
+func secondsSince(start time.Time) float64 {
+	return float64(time.Now().Sub(start).Nanoseconds()) / float64(time.Second)
+}
+
 // Middleware to track metrics
 func metricsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		conns.observeFirstRequest(r, start)
 
 		// Increment request counter
 		atomic.AddUint64(&requestCounter, 1)
+		checkRequestCount()
+		distinctClients.add(clientIP(r))
+		inFlight.Add(1)
+		httpRequestsInFlight.Inc()
+		defer func() {
+			inFlight.Add(-1)
+			httpRequestsInFlight.Dec()
+		}()
+
+		// Count body bytes for requests without a Content-Length
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+		r, cost := withRequestCost(r)
 
 		// Create a response writer wrapper to capture status code
-		wrappedWriter := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		wrappedWriter := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK, start: start}
 
 		// Call the actual handler
 		next(wrappedWriter, r)
+		wrappedWriter.finishServerTiming()
 
 		// Record metrics
-		duration := time.Since(start).Seconds()
+		duration := secondsSince(start)
+		elapsed := time.Since(start)
+		ttfb := elapsed
+		if !wrappedWriter.firstByte.IsZero() {
+			ttfb = wrappedWriter.firstByte.Sub(start)
+		}
+		httpTimeToFirstByte.WithLabelValues(r.URL.Path, r.Method).Observe(ttfb.Seconds())
+		logAccess(r, wrappedWriter, start, elapsed)
 		status := fmt.Sprintf("%d", wrappedWriter.statusCode)
+		if wrappedWriter.statusCode >= 500 {
+			atomic.AddUint64(&errorCounter, 1)
+		} else if !isProbePath(r.URL.Path) {
+			if atomic.AddUint64(&warmupCounter, 1) == readyMinRequests {
+				logEvent(eventWarmupComplete, "Warmup complete", "requests", readyMinRequests)
+			}
+		}
+
+		httpRequestsTotal.WithLabelValues(r.URL.Path, r.Method, status, requestCohort(r)).Inc()
+		httpRequestsByProtocol.WithLabelValues(requestProtocol(r)).Inc()
+		recordRequestCost(r.URL.Path, cost.get())
+		httpRequestSize.WithLabelValues(r.URL.Path, r.Method).Observe(float64(body.size(r)))
+		observer := httpRequestDuration.WithLabelValues(r.URL.Path, r.Method)
+		if traceID := traceIDFromRequest(r); openMetricsEnabled && traceID != "" {
+			// Link the observation to its trace so dashboards can jump to it
+			observer.(prometheus.ExemplarObserver).ObserveWithExemplar(duration, prometheus.Labels{"trace_id": traceID})
+		} else {
+			observer.Observe(duration)
+		}
+	}
+}
+
+// Request body wrapper counting the bytes the handler read
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
 
-		httpRequestsTotal.WithLabelValues(r.URL.Path, r.Method, status).Inc()
-		httpRequestDuration.WithLabelValues(r.URL.Path, r.Method).Observe(duration)
+// Declared Content-Length, or the bytes read for chunked bodies
+func (c *countingReader) size(r *http.Request) int64 {
+	if r.ContentLength >= 0 {
+		return r.ContentLength
 	}
+	return c.n
 }
 
-// Response writer wrapper to capture status code
+// Response writer wrapper to capture status code and body size
 type responseWriter struct {
 	http.ResponseWriter
-	statusCode int
+	statusCode  int
+	bytes       int64
+	wroteHeader bool
+
+	// Request start, for Server-Timing
+	start time.Time
+	// When the status was written; zero if the handler wrote nothing
+	firstByte time.Time
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
-	rw.statusCode = code
+	if !rw.wroteHeader {
+		rw.wroteHeader = true
+		rw.statusCode = code
+		rw.firstByte = time.Now()
+		rw.addServerTiming()
+	}
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-// Health check endpoint
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// Expose the underlying writer to http.ResponseController, for Flush
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Health check endpoint, failing once the watchdog sees a stalled loop
 func healthHandler(w http.ResponseWriter, r *http.Request) {
+	if stalled.Load() {
+		writeErrorBody(w, errorBody{Code: http.StatusServiceUnavailable, Message: "background loop stalled", Reason: "stalled"})
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
 }
 
+// Readiness endpoint, 503 until the server is serving and has handled
+// READY_MIN_REQUESTS successful requests, while a READINESS_DEPS dependency
+// is down or the /api worker pool queue is full, and again during shutdown.
+// Every failing gate is listed in the body so probe failures show all causes.
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	var reasons, messages []string
+	fail := func(reason, message string) {
+		reasons = append(reasons, reason)
+		messages = append(messages, message)
+	}
+
+	// Shutdown clears ready too; report it once, as draining
+	if shuttingDown.Load() {
+		fail("draining", "server is shutting down")
+	} else if !ready.Load() {
+		fail("starting", "server is starting")
+	}
+	if served := atomic.LoadUint64(&warmupCounter); served < readyMinRequests {
+		fail("warming_up", fmt.Sprintf("%d of %d requests served", served, readyMinRequests))
+	}
+	var failing map[string]string
+	if readinessDeps != nil {
+		if failing = readinessDeps.check(r.Context()); len(failing) > 0 {
+			fail("dependencies_down", fmt.Sprintf("%d of %d dependencies down", len(failing), len(readinessDeps.urls)))
+		}
+	}
+	if apiPool != nil && apiPool.full() {
+		fail("overloaded", "worker pool queue full")
+	}
+
+	if len(reasons) > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+		writeErrorBody(w, errorBody{
+			Code:    http.StatusServiceUnavailable,
+			Message: strings.Join(messages, "; "),
+			Reason:  reasons[0],
+			Reasons: reasons,
+			Details: failing,
+		})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// Probe requests must not count towards warmup, or the probes alone would make the pod ready
+func isProbePath(path string) bool {
+	return path == healthPath || path == "/healthz" || path == readyPath
+}
+
 // Sample API endpoint
 func apiHandler(w http.ResponseWriter, r *http.Request) {
-	// Simulate some work
-	time.Sleep(10 * time.Millisecond)
+	// Simulate some work, optionally split into ?ops=N sub-operations
+	ops := 1
+	if v := r.URL.Query().Get("ops"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAPIOps {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("ops must be an integer between 1 and %d", maxAPIOps))
+			return
+		}
+		ops = n
+	}
+	streamBytes, streamRate, err := parseStream(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	setRequestCost(r, float64(ops))
+	simulateWork(r, apiWork(r.URL.Path, ops))
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"status":"success","message":"Hello from scaling-poc!"}`))
+	// Simulate downstream fan-out behind the circuit breaker
+	if downstream.calls > 0 {
+		if !downstreamBreaker.allow() {
+			writeUnavailable(w, "breaker_open", "circuit breaker open")
+			return
+		}
+		err := fanOut(r.Context(), downstream)
+		// A cancelled client says nothing about downstream health
+		if r.Context().Err() == nil {
+			downstreamBreaker.record(err != nil)
+		} else {
+			downstreamBreaker.release()
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusServiceUnavailable, "downstream call failed: "+err.Error())
+			return
+		}
+	}
+
+	if streamBytes > 0 {
+		writeStream(w, r, streamBytes, streamRate)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status":  "success",
+		"message": "Hello from scaling-poc!",
+	})
 }
 
 // Root handler
 func rootHandler(w http.ResponseWriter, r *http.Request) {
+	// "/" matches every unregistered path
+	if r.URL.Path != "/" {
+		writeJSONError(w, http.StatusNotFound, "no route for "+r.URL.Path)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Scaling PoC Application - Go to /api for API endpoint, /metrics for Prometheus metrics"))
+	w.Write([]byte("Scaling PoC Application - Go to /api for API endpoint, /burn to burn CPU, /metrics for Prometheus metrics"))
 }
 
 func main() {
-	// Get port from environment or use default
-	port := os.Getenv("PORT")
+	setupLogging()
+
+	// Bind addresses; repeat the flag or comma-separate to listen on several
+	var bindAddrs stringList
+	flag.Var(&bindAddrs, "bind-address", "address to bind, repeatable or comma-separated (default all interfaces)")
+	snapshotPath := flag.String("metrics-snapshot", "", "file counters are periodically saved to and restored from at startup")
+	snapshotInterval := flag.Duration("metrics-snapshot-interval", 10*time.Second, "how often the metrics snapshot is saved")
+	flag.Float64Var(&flakyErrorRate, "flaky-error-rate", flakyErrorRate, "fraction of /flaky requests that fail")
+	flag.DurationVar(&flakySuccessLatency, "success-latency", flakySuccessLatency, "latency of successful /flaky responses")
+	flag.DurationVar(&flakyErrorLatency, "error-latency", flakyErrorLatency, "latency of failed /flaky responses")
+	flag.Var(&apiLatencySchedule, "latency-schedule", "/api latency over time as offset=duration pairs, e.g. 0s=10ms,60s=200ms,120s=10ms")
+	mirrorURL := flag.String("mirror-url", "", "base URL a fraction of /api requests are mirrored to (fire-and-forget)")
+	mirrorFraction := flag.Float64("mirror-fraction", 1, "fraction of /api requests mirrored to -mirror-url")
+	mirrorConcurrency := flag.Int("mirror-concurrency", 16, "maximum in-flight mirrored requests; extra copies are dropped")
+	metricsAuthFlag := flag.String("metrics-auth", "", "require credentials on /metrics: bearer:TOKEN or basic:USER:PASSWORD (overrides METRICS_AUTH_TOKEN)")
+	proxyProtocol := flag.Bool("proxy-protocol", false, "accept PROXY protocol headers from an L4 load balancer")
+	flag.Uint64Var(&maxRequests, "max-requests", 0, "shut down gracefully after serving this many requests (default never)")
+	var listenOpts listenOptions
+	flag.BoolVar(&listenOpts.reusePort, "reuse-port", false, "set SO_REUSEPORT so several processes can share the port (Linux only)")
+	flag.IntVar(&listenOpts.backlog, "listen-backlog", 0, "accept backlog for listeners, capped by net.core.somaxconn (default system maximum, Linux only)")
+	flag.Parse()
+
+	// Register metrics before anything records to them
+	if err := setupMetrics(); err != nil {
+		log.Fatalf("Failed to register metrics: %v", err)
+	}
+
+	// Get port from environment, PORT_FILE, or use default
+	port := envOrFile("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
+	// Feature settings from the environment
+	loadSettings()
+	maybeCrashOnStart()
+	if flakyErrorRate < 0 || flakyErrorRate > 1 || flakySuccessLatency < 0 || flakyErrorLatency < 0 {
+		log.Fatalf("Invalid /flaky settings: -flaky-error-rate must be in [0,1] and latencies >= 0")
+	}
+	if listenOpts.backlog < 0 {
+		log.Fatalf("Invalid -listen-backlog %d: must be >= 0", listenOpts.backlog)
+	}
+	if baselineMemoryMB > 0 {
+		allocateBaseline(baselineMemoryMB)
+		log.Printf("Retaining %d MB baseline memory", baselineMemoryMB)
+	}
+	if *metricsAuthFlag != "" {
+		creds, err := parseMetricsAuth(*metricsAuthFlag)
+		if err != nil {
+			log.Fatalf("Invalid -metrics-auth: %v", err)
+		}
+		metricsAuth = creds
+	}
+	if *mirrorURL != "" {
+		m, err := newMirror(*mirrorURL, *mirrorFraction, *mirrorConcurrency)
+		if err != nil {
+			log.Fatalf("Invalid mirror settings: %v", err)
+		}
+		apiMirror = m
+		log.Printf("Mirroring %.0f%% of /api requests to %s", *mirrorFraction*100, m.target)
+	}
+
+	// Seed counters from the previous run
+	if *snapshotPath != "" {
+		if *snapshotInterval <= 0 {
+			log.Fatalf("Invalid -metrics-snapshot-interval %s: must be positive", *snapshotInterval)
+		}
+		if err := restoreSnapshot(*snapshotPath); err != nil {
+			log.Printf("Failed to restore metrics snapshot, starting from zero: %v", err)
+		}
+	}
+
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	// Start QPS calculator
-	go calculateQPS(ctx)
+	startBackground(func() { calculateQPS(ctx) })
+	startBackground(func() { calculateErrorRatio(ctx, errorRatio) })
+	startBackground(func() { rotateDistinctClients(ctx, distinctClientsWindow) })
+	startBackground(func() { runWatchdog(ctx) })
+	if ipLimiter != nil {
+		startBackground(func() { ipLimiter.run(ctx) })
+	}
+	if gcPressureMBPerSec > 0 {
+		log.Printf("GC pressure enabled: %g MB/s of garbage", gcPressureMBPerSec)
+		startBackground(func() { runGCPressure(ctx, gcPressureMBPerSec) })
+	}
+	for _, slo := range latencySLOs {
+		startBackground(func() { trackLatencySLO(ctx, slo) })
+	}
+
+	if *snapshotPath != "" {
+		startBackground(func() { runSnapshots(ctx, *snapshotPath, *snapshotInterval) })
+	}
+
+	// Scripted latency profile, timed from startup
+	scheduleStart = scheduleClock.Now()
+	if len(apiLatencySchedule) > 0 {
+		startBackground(func() { runLatencySchedule(ctx, apiLatencySchedule, scheduleStart) })
+	}
+
+	// Optional fixed-capacity worker pool for /api
+	if workerPoolSize > 0 {
+		apiPool = newWorkerPool(workerPoolSize, workerPoolQueue)
+		apiPool.start(ctx)
+		log.Printf("Worker pool enabled for /api: %d workers, queue %d", workerPoolSize, workerPoolQueue)
+	}
 
 	// Setup HTTP routes
-	http.HandleFunc("/", metricsMiddleware(rootHandler))
-	http.HandleFunc("/health", metricsMiddleware(healthHandler))
-	http.HandleFunc("/api", metricsMiddleware(apiHandler))
-	http.Handle("/metrics", promhttp.Handler())
+	router, err := newRouter()
+	if err != nil {
+		log.Fatalf("Invalid routes: %v", err)
+	}
+	logRegisteredMetrics()
 
-	// Setup server
+	// Open all listeners before serving so a bad address fails fast
+	listeners, err := listenAll(listenNetwork, bindAddrs, port, listenOpts)
+	if err != nil {
+		log.Fatalf("Server failed to start: %v", err)
+	}
+	if connIdleTimeout > 0 {
+		listeners = withIdleTimeout(listeners, connIdleTimeout)
+	}
+	if *proxyProtocol {
+		listeners = withProxyProtocol(listeners)
+	}
+
+	// Setup server; one server serves every listener
 	server := &http.Server{
-		Addr:         ":" + port,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		Handler:        router,
+		ConnState:      conns.track,
+		ConnContext:    conns.connContext,
+		MaxHeaderBytes: maxHeaderBytes,
+		ReadTimeout:    10 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		IdleTimeout:    60 * time.Second,
+	}
+
+	// Optional TLS with certificates reloaded on SIGHUP or file change
+	sighup := make(chan struct{}, 1)
+	if tlsCertFile != "" {
+		certs, err := newCertHolder(tlsCertFile, tlsKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+		server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.getCertificate,
+		}
+		startBackground(func() { certs.watch(ctx, tlsReloadInterval, sighup) })
+		log.Printf("TLS enabled with certificate %s", tlsCertFile)
+	}
+
+	// Optional HTTP/3 alongside the TCP listeners, advertised via Alt-Svc
+	var h3 *http3Listener
+	if http3Port != "" {
+		h3, err = newHTTP3Listener(http3Port, router, server.TLSConfig)
+		if err != nil {
+			log.Fatalf("HTTP/3 failed to start: %v", err)
+		}
+		server.Handler = h3.advertise(router)
+		go h3.serve()
+	}
+
+	log.Printf("Probe paths: liveness %s (and /healthz), readiness %s", healthPath, readyPath)
+
+	// Start serving each listener in its own goroutine
+	for _, ln := range listeners {
+		go func(ln net.Listener) {
+			log.Printf("Server listening on %s", ln.Addr())
+			var err error
+			if server.TLSConfig != nil {
+				err = server.ServeTLS(ln, "", "")
+			} else {
+				err = server.Serve(ln)
+			}
+			// Listeners are closed before Shutdown during the ordered shutdown
+			if err != nil && err != http.ErrServerClosed && !errors.Is(err, net.ErrClosed) {
+				log.Fatalf("Server failed on %s: %v", ln.Addr(), err)
+			}
+		}(ln)
 	}
 
-	// Start server in goroutine
-	go func() {
-		log.Printf("Server starting on port %s", port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed to start: %v", err)
+	setReady(true, "serving")
+	logEvent(eventStartupComplete, "Startup complete", "listeners", len(listeners))
+
+	// Optional load against ourselves, stopped with the other background loops
+	if selfLoad.qps > 0 {
+		scheme := "http"
+		if server.TLSConfig != nil {
+			scheme = "https"
 		}
-	}()
+		baseURL := selfURL(listeners[0], scheme)
+		log.Printf("Self-load enabled: %.1f QPS to %s%s", selfLoad.qps, baseURL, selfLoad.path)
+		startBackground(func() { runSelfLoad(ctx, selfLoad, baseURL) })
+	}
 
-	// Wait for interrupt signal
+	// Wait for interrupt signal or an internal shutdown request; SIGHUP
+	// reloads the TLS certificate instead
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	reason := ""
+	graceDelay := shutdownGraceDelay
+	for reason == "" {
+		select {
+		case sig := <-quit:
+			if sig != syscall.SIGHUP {
+				reason = sig.String()
+				graceDelay = graceDelayFor(sig)
+				continue
+			}
+			select {
+			case sighup <- struct{}{}:
+			default:
+			}
+		case reason = <-shutdownRequests:
+		}
+	}
 
-	log.Println("Server shutting down...")
+	logEvent(eventShutdownStarted, "Server shutting down", "reason", reason, "grace_delay", graceDelay.String())
 
-	// Graceful shutdown
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	// Ordered shutdown, all phases share one overall timeout on top of the
+	// grace delay
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), graceDelay+shutdownTimeout)
 	defer shutdownCancel()
 
-	if err := server.Shutdown(shutdownCtx); err != nil {
+	err = runShutdown(shutdownCtx, []shutdownPhase{
+		{"readiness", func(ctx context.Context) error {
+			shuttingDown.Store(true)
+			setReady(false, "shutting down")
+			return nil
+		}},
+		{"grace-delay", func(ctx context.Context) error {
+			return waitGraceDelay(ctx, graceDelay)
+		}},
+		{"reject", func(ctx context.Context) error {
+			draining.Store(true)
+			logEvent(eventDrainStarted, "Drain started")
+			return nil
+		}},
+		{"stop-accepting", func(ctx context.Context) error {
+			server.SetKeepAlivesEnabled(false)
+			for _, ln := range listeners {
+				ln.Close()
+			}
+			return nil
+		}},
+		{"drain", func(ctx context.Context) error {
+			// Drain gets part of the timeout so the later phases can still run
+			drainCtx, drainCancel := context.WithTimeout(ctx, drainTimeout)
+			defer drainCancel()
+
+			// HTTP/3 drains alongside TCP within the same window
+			h3Done := make(chan error, 1)
+			if h3 != nil {
+				go func() { h3Done <- h3.shutdown(drainCtx) }()
+			} else {
+				h3Done <- nil
+			}
+			err := errors.Join(server.Shutdown(drainCtx), <-h3Done)
+			if err == nil || shutdownFatalOnTimeout {
+				return err
+			}
+			open := conns.open.Load()
+			server.Close()
+			if h3 != nil {
+				h3.close()
+			}
+			log.Printf("Graceful drain timed out after %s, forcibly closed %d connections", drainTimeout, open)
+			return nil
+		}},
+		{"background", func(ctx context.Context) error {
+			cancel()
+			return waitBackground(ctx)
+		}},
+		{"flush", func(ctx context.Context) error {
+			if *snapshotPath != "" {
+				if err := saveSnapshot(*snapshotPath); err != nil {
+					return err
+				}
+			}
+			return flushMetrics(ctx)
+		}},
+	})
+	if err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
-	log.Println("Server stopped")
+	logEvent(eventShutdownComplete, "Server stopped")
 }
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Set *p to v for the rest of the test; tests share the package globals, so
+// none of them run in parallel
+func setVar[T any](t *testing.T, p *T, v T) {
+	t.Helper()
+	old := *p
+	*p = v
+	t.Cleanup(func() { *p = old })
+}
+
+// Same as setVar for an atomic.Int64 setting such as apiLatency
+func setAtomic(t *testing.T, p *atomic.Int64, v int64) {
+	t.Helper()
+	old := p.Swap(v)
+	t.Cleanup(func() { p.Store(old) })
+}
+
+// Same as setVar for an atomic.Bool flag such as ready
+func setBool(t *testing.T, p *atomic.Bool, v bool) {
+	t.Helper()
+	old := p.Swap(v)
+	t.Cleanup(func() { p.Store(old) })
+}
+
+// Current value of a counter or gauge
+func metricValue(t *testing.T, m prometheus.Metric) float64 {
+	t.Helper()
+	var pb dto.Metric
+	if err := m.Write(&pb); err != nil {
+		t.Fatalf("read metric: %v", err)
+	}
+	if pb.Counter != nil {
+		return pb.GetCounter().GetValue()
+	}
+	return pb.GetGauge().GetValue()
+}
+
+// Sample count and sum of a histogram
+func histogramValue(t *testing.T, m prometheus.Metric) (uint64, float64) {
+	t.Helper()
+	var pb dto.Metric
+	if err := m.Write(&pb); err != nil {
+		t.Fatalf("read metric: %v", err)
+	}
+	return pb.GetHistogram().GetSampleCount(), pb.GetHistogram().GetSampleSum()
+}
+
+// Router with every route, built from the current settings
+func newTestRouter(t *testing.T) *router {
+	t.Helper()
+	rt, err := newRouter()
+	if err != nil {
+		t.Fatalf("newRouter: %v", err)
+	}
+	return rt
+}
+
+// Serve one request and return the recorded response
+func serve(h http.Handler, method, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	return rec
+}
+
+// Every tick drops the sample that fell out of the window and feeds the
+// window average into the smoothed rate
+func TestQPSWindowRollover(t *testing.T) {
+	setAtomic(t, &qpsWindow, 3)
+	setVar(t, &requestCounter, 0)
+	c := newQPSCalculator(prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_duration_seconds"}))
+
+	tests := []struct {
+		requests uint64 // during the tick
+		qps      float64
+	}{
+		{10, 10},      // window still filling: 10 over 1s
+		{20, 15},      // 30 over 2s
+		{30, 20},      // 60 over 3s
+		{0, 50.0 / 3}, // the first second rolls out
+		{0, 10},       // only the third second is left
+		{0, 0},        // idle window
+		{9, 3},        // traffic again
+	}
+	smoothed := 0.0
+	for i, tt := range tests {
+		atomic.AddUint64(&requestCounter, tt.requests)
+		c.tick()
+		smoothed += qpsSmoothing * (tt.qps - smoothed)
+		if got := metricValue(t, currentQPS); math.Abs(got-tt.qps) > 1e-9 {
+			t.Errorf("tick %d: qps = %g, want %g", i+1, got, tt.qps)
+		}
+		if got := metricValue(t, smoothedQPS); math.Abs(got-smoothed) > 1e-9 {
+			t.Errorf("tick %d: smoothed qps = %g, want %g", i+1, got, smoothed)
+		}
+	}
+}
+
+// Near-instant requests keep their sub-microsecond duration rather than
+// rounding to zero
+func TestSecondsSinceResolution(t *testing.T) {
+	tests := []time.Duration{0, 300 * time.Nanosecond, 20 * time.Microsecond, 3 * time.Millisecond}
+	for _, ago := range tests {
+		got := secondsSince(time.Now().Add(-ago))
+		if got <= 0 || got < ago.Seconds() || got > ago.Seconds()+0.01 {
+			t.Errorf("%s ago: %g seconds", ago, got)
+		}
+	}
+
+	// A no-op handler lands in a sub-microsecond bucket above zero
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "test_instant_seconds",
+		Buckets: prometheus.ExponentialBuckets(1e-9, 10, 7), // 1ns to 1ms
+	})
+	start := time.Now()
+	h.Observe(secondsSince(start))
+
+	var pb dto.Metric
+	if err := h.Write(&pb); err != nil {
+		t.Fatal(err)
+	}
+	if sum := pb.GetHistogram().GetSampleSum(); sum <= 0 || sum >= 1e-3 {
+		t.Errorf("near-instant observation %g, want within (0, 1ms)", sum)
+	}
+	if b := pb.GetHistogram().GetBucket(); b[0].GetCumulativeCount() != 0 {
+		t.Errorf("near-instant observation fell in the %gs bucket", b[0].GetUpperBound())
+	}
+}
+
+// Request bodies are measured by Content-Length, or by the bytes read when
+// chunked
+func TestRequestSize(t *testing.T) {
+	readAll := metricsMiddleware(func(w http.ResponseWriter, r *http.Request) { io.Copy(io.Discard, r.Body) })
+	readNone := metricsMiddleware(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		body    string
+		chunked bool
+		size    float64
+	}{
+		{"no body", readAll, "", false, 0},
+		{"content length", readAll, strings.Repeat("x", 1000), false, 1000},
+		{"content length unread", readNone, strings.Repeat("x", 700), false, 700},
+		{"chunked", readAll, strings.Repeat("x", 4096), true, 4096},
+		{"chunked unread", readNone, strings.Repeat("x", 4096), true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader = strings.NewReader(tt.body)
+			if tt.chunked {
+				body = io.MultiReader(body) // hides the length
+			}
+			req := httptest.NewRequest(http.MethodPost, "/size", body)
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			hist := httpRequestSize.WithLabelValues("/size", http.MethodPost).(prometheus.Metric)
+			count, sum := histogramValue(t, hist)
+
+			tt.handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			newCount, newSum := histogramValue(t, hist)
+			if newCount-count != 1 || newSum-sum != tt.size {
+				t.Errorf("%d observations summing to %g bytes, want 1 of %g", newCount-count, newSum-sum, tt.size)
+			}
+		})
+	}
+}
+
+// TTFB ends when the handler writes the status, which for a stream comes
+// well before the end of the request; a handler that writes nothing gets
+// its whole duration
+func TestTimeToFirstByte(t *testing.T) {
+	const pause = 100 * time.Millisecond
+	tests := []struct {
+		name      string
+		handler   http.HandlerFunc
+		streaming bool // TTFB well below the total
+	}{
+		{"stream", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("first"))
+			http.NewResponseController(w).Flush()
+			time.Sleep(pause)
+			w.Write([]byte("last"))
+		}, true},
+		{"status first", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			time.Sleep(pause)
+		}, true},
+		{"slow then write", func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(pause)
+			w.Write([]byte("done"))
+		}, false},
+		{"no write", func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(pause)
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ttfbHist := httpTimeToFirstByte.WithLabelValues("/ttfb", http.MethodGet).(prometheus.Metric)
+			totalHist := httpRequestDuration.WithLabelValues("/ttfb", http.MethodGet).(prometheus.Metric)
+			ttfbCount, ttfbSum := histogramValue(t, ttfbHist)
+			_, totalSum := histogramValue(t, totalHist)
+
+			serve(metricsMiddleware(tt.handler), http.MethodGet, "/ttfb")
+
+			newCount, newSum := histogramValue(t, ttfbHist)
+			_, newTotal := histogramValue(t, totalHist)
+			ttfb, total := newSum-ttfbSum, newTotal-totalSum
+			if newCount-ttfbCount != 1 {
+				t.Fatalf("%d TTFB observations, want 1", newCount-ttfbCount)
+			}
+			if total < pause.Seconds() {
+				t.Errorf("duration %gs, want at least %s", total, pause)
+			}
+			if tt.streaming && ttfb > total-pause.Seconds()*8/10 {
+				t.Errorf("TTFB %gs of %gs total, want well below", ttfb, total)
+			}
+			if !tt.streaming && ttfb < pause.Seconds() {
+				t.Errorf("TTFB %gs of %gs total, want about the total", ttfb, total)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Gauge for memory deliberately held by the process
+	retainedMemoryBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "retained_memory_bytes",
+			Help: "Bytes of memory deliberately retained by the process",
+		},
+	)
+
+	// Size of the startup allocation, from BASELINE_MEMORY_MB
+	baselineMemoryMB int
+
+	// Held for the process lifetime so the baseline stays resident
+	baselineMemory []byte
+)
+
+// Allocate the baseline block and write to every page so the OS backs it
+// with real memory; an untouched allocation would not show up in RSS
+func allocateBaseline(mb int) {
+	if mb <= 0 {
+		return
+	}
+	baselineMemory = make([]byte, mb<<20)
+	page := os.Getpagesize()
+	for i := 0; i < len(baselineMemory); i += page {
+		baselineMemory[i] = 1
+	}
+	retainedMemoryBytes.Add(float64(len(baselineMemory)))
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	// Histogram for the time between successive /metrics scrapes
+	metricsScrapeInterval = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "metrics_scrape_interval_seconds",
+			Help:    "Time between successive authorized /metrics scrapes, from any scraper",
+			Buckets: []float64{1, 2.5, 5, 10, 15, 20, 30, 45, 60, 120, 300},
+		},
+	)
+
+	// Unix nanoseconds of the previous scrape; 0 before the first
+	lastScrape atomic.Int64
+
+	// Counter for scrapes rejected for missing or wrong credentials
+	metricsUnauthorizedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "metrics_unauthorized_total",
+			Help: "Total number of /metrics requests rejected as unauthorized",
+		},
+	)
+
+	// Credentials required to scrape /metrics, from -metrics-auth or
+	// METRICS_AUTH_TOKEN; the zero value leaves it open
+	metricsAuth metricsCredentials
+
+	// Log every scrape, from METRICS_ACCESS_LOG
+	metricsAccessLog bool
+
+	// Never gzip scrapes, from METRICS_DISABLE_COMPRESSION; by default
+	// responses are gzipped when the scraper sends Accept-Encoding: gzip
+	metricsDisableCompression bool
+)
+
+// Build the /metrics handler with optional auth and access logging
+func newMetricsHandler() http.Handler {
+	opts := promhttp.HandlerOpts{
+		EnableOpenMetrics:  openMetricsEnabled,
+		DisableCompression: metricsDisableCompression,
+	}
+	all := promhttp.HandlerFor(metricsRegistry, opts)
+	filtered := func(w http.ResponseWriter, r *http.Request) {
+		names := r.URL.Query()["name[]"]
+		if len(names) == 0 {
+			all.ServeHTTP(w, r)
+			return
+		}
+		promhttp.HandlerFor(filterFamilies(metricsRegistry, names), opts).ServeHTTP(w, r)
+	}
+	h := promhttp.InstrumentMetricHandler(metricsRegisterer, http.HandlerFunc(filtered))
+	return protectMetrics(timeScrapes(h))
+}
+
+// Restrict a gatherer to the named metric families, as selected by
+// /metrics?name[]=http_requests_total&name[]=http_requests_per_second. Any
+// family in the registry can be named: the app's own metrics, go_* and
+// process_* from the runtime collectors, and promhttp_* for the handler
+// itself. Histograms and summaries are named without the _bucket, _sum or
+// _count suffix; unknown names select nothing. Everything is still gathered,
+// so this saves transfer and parsing, not collection.
+func filterFamilies(g prometheus.Gatherer, names []string) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+		return slices.DeleteFunc(families, func(mf *dto.MetricFamily) bool {
+			return !slices.Contains(names, mf.GetName())
+		}), err
+	})
+}
+
+// Observe the time since the previous scrape. Only the timestamp is taken
+// here, nothing is gathered, so this adds no work to the scrape itself. With
+// several scrapers, e.g. an HA Prometheus pair, intervals interleave.
+func timeScrapes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now().UnixNano()
+		if prev := lastScrape.Swap(now); prev != 0 {
+			metricsScrapeInterval.Observe(time.Duration(now - prev).Seconds())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Apply the /metrics auth and scrape logging settings to a metrics endpoint
+func protectMetrics(h http.Handler) http.Handler {
+	if metricsAuth.secret != "" {
+		h = requireCredentials(metricsAuth, h)
+	}
+	if metricsAccessLog {
+		h = logScrapes(h)
+	}
+	return h
+}
+
+// Credentials accepted on /metrics
+type metricsCredentials struct {
+	// Accept the secret as a bearer token, as the basic-auth password, or both
+	bearer, basic bool
+	// Required basic-auth user name; empty accepts any
+	user   string
+	secret string
+}
+
+// A token accepted as a bearer token or as the basic-auth password, so both
+// Prometheus authorization and basic_auth scrape configs work
+func tokenCredentials(token string) metricsCredentials {
+	return metricsCredentials{bearer: true, basic: true, secret: token}
+}
+
+// Parse -metrics-auth: bearer:TOKEN or basic:USER:PASSWORD
+func parseMetricsAuth(value string) (metricsCredentials, error) {
+	scheme, rest, _ := strings.Cut(value, ":")
+	switch scheme {
+	case "bearer":
+		if rest != "" {
+			return metricsCredentials{bearer: true, secret: rest}, nil
+		}
+	case "basic":
+		if user, password, ok := strings.Cut(rest, ":"); ok && user != "" && password != "" {
+			return metricsCredentials{basic: true, user: user, secret: password}, nil
+		}
+	}
+	return metricsCredentials{}, fmt.Errorf("want bearer:TOKEN or basic:USER:PASSWORD")
+}
+
+// Reject requests without matching credentials with 401
+func requireCredentials(creds metricsCredentials, next http.Handler) http.Handler {
+	challenge := `Bearer realm="metrics"`
+	if !creds.bearer {
+		challenge = `Basic realm="metrics"`
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !creds.matches(r) {
+			metricsUnauthorizedTotal.Inc()
+			w.Header().Set("WWW-Authenticate", challenge)
+			writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Compare in constant time so the secret cannot be guessed from timing
+func (c metricsCredentials) matches(r *http.Request) bool {
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && c.bearer {
+		return subtle.ConstantTimeCompare([]byte(bearer), []byte(c.secret)) == 1
+	}
+	user, password, ok := r.BasicAuth()
+	if !ok || !c.basic {
+		return false
+	}
+	userOK := c.user == "" || subtle.ConstantTimeCompare([]byte(user), []byte(c.user)) == 1
+	return subtle.ConstantTimeCompare([]byte(password), []byte(c.secret)) == 1 && userOK
+}
+
+// Log one line per scrape with the caller, status and duration
+func logScrapes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(wrapped, r)
+		log.Printf("Metrics scrape from %s: status %d in %s", r.RemoteAddr, wrapped.statusCode, time.Since(start))
+	})
+}
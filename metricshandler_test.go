@@ -0,0 +1,181 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Scrape body without the promhttp_* self-metrics, which change every scrape
+func scrapeBody(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body io.Reader = rec.Body
+	if rec.Header().Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(rec.Body)
+		if err != nil {
+			t.Fatalf("gzip: %v", err)
+		}
+		body = zr
+	}
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("read scrape: %v", err)
+	}
+	var lines []string
+	for _, line := range strings.Split(string(raw), "\n") {
+		if !strings.Contains(line, "promhttp_") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Scrapes are gzipped when asked for, unless compression is disabled, and
+// decode to the same content as an uncompressed scrape
+func TestMetricsGzip(t *testing.T) {
+	useTestRegistry(t)
+	series := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_series_total", Help: "Many series"}, []string{"n"})
+	metricsRegistry.MustRegister(series)
+	for i := 0; i < 500; i++ {
+		series.WithLabelValues(fmt.Sprint(i)).Add(float64(i))
+	}
+	plain := scrapeBody(t, serve(newMetricsHandler(), http.MethodGet, "/metrics"))
+	if !strings.Contains(plain, `test_series_total{n="499"} 499`) {
+		t.Fatalf("uncompressed scrape is missing series:\n%.500s", plain)
+	}
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		disable        bool
+		gzipped        bool
+	}{
+		{"gzip accepted", "gzip", false, true},
+		{"gzip among others", "br, gzip;q=0.8", false, true},
+		{"not accepted", "", false, false},
+		{"compression disabled", "gzip", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setVar(t, &metricsDisableCompression, tt.disable)
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			newMetricsHandler().ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Content-Encoding") == "gzip"; got != tt.gzipped {
+				t.Errorf("gzipped %v, want %v", got, tt.gzipped)
+			}
+			if got := scrapeBody(t, rec); got != plain {
+				t.Errorf("scrape differs from the uncompressed one")
+			}
+		})
+	}
+}
+
+func TestParseMetricsAuth(t *testing.T) {
+	tests := []struct {
+		value string
+		creds metricsCredentials
+		ok    bool
+	}{
+		{"bearer:s3cret", metricsCredentials{bearer: true, secret: "s3cret"}, true},
+		{"basic:prom:pa:ss", metricsCredentials{basic: true, user: "prom", secret: "pa:ss"}, true},
+		{"bearer:", metricsCredentials{}, false},
+		{"basic:prom", metricsCredentials{}, false},
+		{"basic::pass", metricsCredentials{}, false},
+		{"digest:x", metricsCredentials{}, false},
+		{"s3cret", metricsCredentials{}, false},
+	}
+	for _, tt := range tests {
+		creds, err := parseMetricsAuth(tt.value)
+		if (err == nil) != tt.ok || creds != tt.creds {
+			t.Errorf("%q: %+v, error %v, want %+v ok %v", tt.value, creds, err, tt.creds, tt.ok)
+		}
+	}
+}
+
+// Scrapes need the configured credentials once -metrics-auth is set, and
+// stay open without it
+func TestMetricsAuth(t *testing.T) {
+	useTestRegistry(t)
+	bearer := metricsCredentials{bearer: true, secret: "s3cret"}
+	basic := metricsCredentials{basic: true, user: "prom", secret: "s3cret"}
+
+	tests := []struct {
+		name   string
+		creds  metricsCredentials
+		auth   func(r *http.Request)
+		status int
+	}{
+		{"open", metricsCredentials{}, func(r *http.Request) {}, http.StatusOK},
+		{"bearer missing", bearer, func(r *http.Request) {}, http.StatusUnauthorized},
+		{"bearer wrong", bearer, func(r *http.Request) { r.Header.Set("Authorization", "Bearer guess") }, http.StatusUnauthorized},
+		{"bearer right", bearer, func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }, http.StatusOK},
+		{"bearer sent as basic", bearer, func(r *http.Request) { r.SetBasicAuth("prom", "s3cret") }, http.StatusUnauthorized},
+		{"basic right", basic, func(r *http.Request) { r.SetBasicAuth("prom", "s3cret") }, http.StatusOK},
+		{"basic wrong user", basic, func(r *http.Request) { r.SetBasicAuth("admin", "s3cret") }, http.StatusUnauthorized},
+		{"basic wrong password", basic, func(r *http.Request) { r.SetBasicAuth("prom", "guess") }, http.StatusUnauthorized},
+		{"basic sent as bearer", basic, func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setVar(t, &metricsAuth, tt.creds)
+			unauthorized := metricValue(t, metricsUnauthorizedTotal)
+			for _, h := range []http.Handler{newMetricsHandler(), protectMetrics(http.HandlerFunc(metricsJSONHandler))} {
+				req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+				tt.auth(req)
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, req)
+				if rec.Code != tt.status {
+					t.Errorf("status %d, want %d", rec.Code, tt.status)
+				}
+				if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+					t.Error("401 without a WWW-Authenticate challenge")
+				}
+			}
+			want := 0.0
+			if tt.status == http.StatusUnauthorized {
+				want = 2
+			}
+			if got := metricValue(t, metricsUnauthorizedTotal) - unauthorized; got != want {
+				t.Errorf("metrics_unauthorized_total grew by %g, want %g", got, want)
+			}
+		})
+	}
+}
+
+// ADMIN_TOKEN is accepted as a bearer token or basic-auth password
+func TestAdminAuth(t *testing.T) {
+	h := adminAuth(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		name   string
+		token  string
+		auth   func(r *http.Request)
+		status int
+	}{
+		{"no token configured", "", func(r *http.Request) {}, http.StatusOK},
+		{"missing", "t0ken", func(r *http.Request) {}, http.StatusUnauthorized},
+		{"bearer", "t0ken", func(r *http.Request) { r.Header.Set("Authorization", "Bearer t0ken") }, http.StatusOK},
+		{"basic", "t0ken", func(r *http.Request) { r.SetBasicAuth("anyone", "t0ken") }, http.StatusOK},
+		{"wrong", "t0ken", func(r *http.Request) { r.Header.Set("Authorization", "Bearer t0k3n") }, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		setVar(t, &adminToken, tt.token)
+		req := httptest.NewRequest(http.MethodGet, "/admin/events", nil)
+		tt.auth(req)
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.status)
+		}
+	}
+}
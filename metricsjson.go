@@ -0,0 +1,122 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// JSON form of a metric family served on /metrics.json:
+//
+//	{"metrics": [{"name": "http_requests_total", "help": "...", "type": "counter",
+//	  "samples": [{"labels": {"path": "/api", ...}, "value": 42}]}]}
+//
+// Counters, gauges and untyped metrics have "value"; histograms have
+// "count", "sum" and cumulative "buckets" of {"le", "count"}; summaries have
+// "count", "sum" and "quantiles" of {"quantile", "value"}. Non-finite
+// numbers are the strings "NaN", "+Inf" and "-Inf".
+type jsonFamily struct {
+	Name    string       `json:"name"`
+	Help    string       `json:"help"`
+	Type    string       `json:"type"`
+	Samples []jsonSample `json:"samples"`
+}
+
+type jsonSample struct {
+	Labels    map[string]string `json:"labels"`
+	Value     *jsonFloat        `json:"value,omitempty"`
+	Count     *uint64           `json:"count,omitempty"`
+	Sum       *jsonFloat        `json:"sum,omitempty"`
+	Buckets   []jsonBucket      `json:"buckets,omitempty"`
+	Quantiles []jsonQuantile    `json:"quantiles,omitempty"`
+}
+
+type jsonBucket struct {
+	LE    jsonFloat `json:"le"`
+	Count uint64    `json:"count"`
+}
+
+type jsonQuantile struct {
+	Quantile jsonFloat `json:"quantile"`
+	Value    jsonFloat `json:"value"`
+}
+
+// Float that encodes NaN and infinities as strings, which JSON numbers cannot hold
+type jsonFloat float64
+
+func (f jsonFloat) MarshalJSON() ([]byte, error) {
+	v := float64(f)
+	switch {
+	case math.IsNaN(v):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(v, 1):
+		return []byte(`"+Inf"`), nil
+	case math.IsInf(v, -1):
+		return []byte(`"-Inf"`), nil
+	}
+	return strconv.AppendFloat(nil, v, 'g', -1, 64), nil
+}
+
+func newJSONFloat(v float64) *jsonFloat {
+	f := jsonFloat(v)
+	return &f
+}
+
+// Serve the registry as JSON for consumers that cannot parse the exposition format
+func metricsJSONHandler(w http.ResponseWriter, r *http.Request) {
+	families, err := metricsRegistry.Gather()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "gathering metrics failed: "+err.Error())
+		return
+	}
+
+	out := make([]jsonFamily, 0, len(families))
+	for _, mf := range families {
+		out = append(out, toJSONFamily(mf))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"metrics": out})
+}
+
+func toJSONFamily(mf *dto.MetricFamily) jsonFamily {
+	family := jsonFamily{
+		Name:    mf.GetName(),
+		Help:    mf.GetHelp(),
+		Type:    strings.ToLower(mf.GetType().String()),
+		Samples: make([]jsonSample, 0, len(mf.GetMetric())),
+	}
+	for _, m := range mf.GetMetric() {
+		s := jsonSample{Labels: make(map[string]string, len(m.GetLabel()))}
+		for _, l := range m.GetLabel() {
+			s.Labels[l.GetName()] = l.GetValue()
+		}
+
+		switch {
+		case m.Counter != nil:
+			s.Value = newJSONFloat(m.Counter.GetValue())
+		case m.Gauge != nil:
+			s.Value = newJSONFloat(m.Gauge.GetValue())
+		case m.Untyped != nil:
+			s.Value = newJSONFloat(m.Untyped.GetValue())
+		case m.Histogram != nil:
+			count := m.Histogram.GetSampleCount()
+			s.Count = &count
+			s.Sum = newJSONFloat(m.Histogram.GetSampleSum())
+			for _, b := range m.Histogram.GetBucket() {
+				s.Buckets = append(s.Buckets, jsonBucket{LE: jsonFloat(b.GetUpperBound()), Count: b.GetCumulativeCount()})
+			}
+			s.Buckets = append(s.Buckets, jsonBucket{LE: jsonFloat(math.Inf(1)), Count: count})
+		case m.Summary != nil:
+			count := m.Summary.GetSampleCount()
+			s.Count = &count
+			s.Sum = newJSONFloat(m.Summary.GetSampleSum())
+			for _, q := range m.Summary.GetQuantile() {
+				s.Quantiles = append(s.Quantiles, jsonQuantile{Quantile: jsonFloat(q.GetQuantile()), Value: jsonFloat(q.GetValue())})
+			}
+		}
+		family.Samples = append(family.Samples, s)
+	}
+	return family
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Each metric type is served with its labels and the documented value fields
+func TestMetricsJSON(t *testing.T) {
+	useTestRegistry(t)
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_nan", Help: "Not a number"})
+	hist := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_seconds", Help: "Durations", Buckets: []float64{0.1, 1}})
+	summary := prometheus.NewSummary(prometheus.SummaryOpts{Name: "test_summary", Help: "Quantiles", Objectives: map[float64]float64{0.5: 0.05}})
+	for _, c := range []prometheus.Collector{httpRequestsTotal, gauge, hist, summary} {
+		metricsRegisterer.MustRegister(c)
+	}
+
+	// Earlier tests may have counted other requests, so use labels of our own
+	httpRequestsTotal.WithLabelValues("/json", http.MethodGet, "200", "canary").Add(3)
+	gauge.Set(math.NaN())
+	hist.Observe(0.05)
+	hist.Observe(0.5)
+	hist.Observe(5)
+	summary.Observe(2)
+
+	rec := serve(http.HandlerFunc(metricsJSONHandler), http.MethodGet, "/metrics.json")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+	var body struct {
+		Metrics []struct {
+			Name    string           `json:"name"`
+			Help    string           `json:"help"`
+			Type    string           `json:"type"`
+			Samples []map[string]any `json:"samples"`
+		} `json:"metrics"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body is not JSON: %v\n%s", err, rec.Body)
+	}
+
+	tests := []struct {
+		name   string
+		typ    string
+		help   string
+		sample map[string]any
+	}{
+		{"http_requests_total", "counter", "Total number of HTTP requests, by ?cohort= tag", map[string]any{
+			"labels": map[string]any{"path": "/json", "method": "GET", "status": "200", "cohort": "canary"},
+			"value":  3.0,
+		}},
+		{"test_nan", "gauge", "Not a number", map[string]any{
+			"labels": map[string]any{},
+			"value":  "NaN",
+		}},
+		{"test_seconds", "histogram", "Durations", map[string]any{
+			"labels": map[string]any{},
+			"count":  3.0,
+			"sum":    5.55,
+			"buckets": []any{
+				map[string]any{"le": 0.1, "count": 1.0},
+				map[string]any{"le": 1.0, "count": 2.0},
+				map[string]any{"le": "+Inf", "count": 3.0},
+			},
+		}},
+		{"test_summary", "summary", "Quantiles", map[string]any{
+			"labels":    map[string]any{},
+			"count":     1.0,
+			"sum":       2.0,
+			"quantiles": []any{map[string]any{"quantile": 0.5, "value": 2.0}},
+		}},
+	}
+	for _, tt := range tests {
+		found := false
+		for _, f := range body.Metrics {
+			if f.Name != tt.name {
+				continue
+			}
+			if f.Type != tt.typ || f.Help != tt.help {
+				t.Errorf("%s: type %q help %q, want %q %q", tt.name, f.Type, f.Help, tt.typ, tt.help)
+			}
+			for _, s := range f.Samples {
+				if reflect.DeepEqual(s["labels"], tt.sample["labels"]) {
+					found = true
+					if !reflect.DeepEqual(s, tt.sample) {
+						t.Errorf("%s sample\n%v, want\n%v", tt.name, s, tt.sample)
+					}
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%s with labels %v missing from /metrics.json", tt.name, tt.sample["labels"])
+		}
+	}
+}
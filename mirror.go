@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Counter for mirrored requests, by result: sent, failed or dropped
+	mirrorRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mirror_requests_total",
+			Help: "Requests selected for mirroring, by result (sent, failed, dropped)",
+		},
+		[]string{"result"},
+	)
+
+	// Mirror for /api traffic; nil unless -mirror-url is set
+	apiMirror *mirror
+
+	// Client for mirrored requests
+	mirrorClient = &http.Client{Timeout: 5 * time.Second}
+)
+
+// Fire-and-forget copy of a fraction of requests to a shadow target
+type mirror struct {
+	// Base URL; the request path and query are appended
+	target *url.URL
+	// Fraction of requests mirrored, in [0,1]
+	fraction float64
+	// Slots for in-flight mirrored requests; when full the copy is dropped
+	slots chan struct{}
+}
+
+func newMirror(target string, fraction float64, concurrency int) (*mirror, error) {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("mirror URL %q must be an absolute http(s) URL", target)
+	}
+	if fraction < 0 || fraction > 1 {
+		return nil, fmt.Errorf("mirror fraction %v must be in [0,1]", fraction)
+	}
+	if concurrency < 1 {
+		return nil, fmt.Errorf("mirror concurrency %d must be at least 1", concurrency)
+	}
+	return &mirror{target: u, fraction: fraction, slots: make(chan struct{}, concurrency)}, nil
+}
+
+// Mirror a fraction of requests to apiMirror before serving them; the
+// client response never waits on or depends on the mirror
+func mirrored(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if m := apiMirror; m != nil && rand.Float64() < m.fraction {
+			m.send(r)
+		}
+		next(w, r)
+	}
+}
+
+// Copy r and send it in the background, dropping it if all slots are busy.
+// The body is buffered so both the handler and the mirror can read it.
+func (m *mirror) send(r *http.Request) {
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		mirrorRequestsTotal.WithLabelValues("dropped").Inc()
+		return
+	}
+
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			// Let the handler see the same failure; nothing to mirror
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), errReader{err}))
+			<-m.slots
+			mirrorRequestsTotal.WithLabelValues("dropped").Inc()
+			return
+		}
+	}
+
+	u := *m.target
+	u.Path = strings.TrimSuffix(u.Path, "/") + r.URL.Path
+	u.RawQuery = r.URL.RawQuery
+	header := r.Header.Clone()
+	method := r.Method
+
+	go func() {
+		defer func() { <-m.slots }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), mirrorClient.Timeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+		if err != nil {
+			mirrorRequestsTotal.WithLabelValues("failed").Inc()
+			return
+		}
+		req.Header = header
+		req.Header.Set("X-Mirrored", "1")
+
+		resp, err := mirrorClient.Do(req)
+		if err != nil {
+			mirrorRequestsTotal.WithLabelValues("failed").Inc()
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		mirrorRequestsTotal.WithLabelValues("sent").Inc()
+	}()
+}
+
+// Reader returning a fixed error
+type errReader struct{ err error }
+
+func (e errReader) Read([]byte) (int, error) { return 0, e.err }
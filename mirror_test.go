@@ -0,0 +1,165 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Fake mirror target recording what it received
+type mirrorTarget struct {
+	*httptest.Server
+	mu       sync.Mutex
+	received []string // method, URI and body of each request
+	release  chan struct{}
+}
+
+func newMirrorTarget(t *testing.T) *mirrorTarget {
+	m := &mirrorTarget{}
+	m.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.release != nil {
+			<-m.release
+		}
+		body, _ := io.ReadAll(r.Body)
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if r.Header.Get("X-Mirrored") == "1" {
+			m.received = append(m.received, r.Method+" "+r.URL.RequestURI()+" "+string(body))
+		}
+	}))
+	t.Cleanup(m.Close)
+	return m
+}
+
+// Wait until the sent, failed and dropped counters grew by n in total
+func waitMirrored(t *testing.T, before float64, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		if mirrorResults(t)-before >= float64(n) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%g of %d mirrored requests finished", mirrorResults(t)-before, n)
+		}
+	}
+}
+
+func mirrorResults(t *testing.T) float64 {
+	total := 0.0
+	for _, result := range []string{"sent", "failed", "dropped"} {
+		total += metricValue(t, mirrorRequestsTotal.WithLabelValues(result))
+	}
+	return total
+}
+
+// The configured fraction of requests reaches the mirror with its method,
+// path, query and body, while clients get the normal response
+func TestMirrorFraction(t *testing.T) {
+	tests := []struct {
+		name     string
+		fraction float64
+		requests int
+		min, max int // mirrored requests
+	}{
+		{"all", 1, 20, 20, 20},
+		{"none", 0, 20, 0, 0},
+		{"half", 0.5, 400, 140, 260},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := newMirrorTarget(t)
+			m, err := newMirror(target.URL+"/shadow/", tt.fraction, 1000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			setVar(t, &apiMirror, m)
+			h := mirrored(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				w.Write(body)
+			})
+
+			before := mirrorResults(t)
+			for i := 0; i < tt.requests; i++ {
+				rec := httptest.NewRecorder()
+				h(rec, httptest.NewRequest(http.MethodPost, "/api?ops=2", strings.NewReader("payload")))
+				if rec.Code != http.StatusOK || rec.Body.String() != "payload" {
+					t.Fatalf("client response %d %q, want the handler's", rec.Code, rec.Body)
+				}
+			}
+			// Deselected requests leave no trace, so only wait for a floor
+			waitMirrored(t, before, tt.min)
+			time.Sleep(50 * time.Millisecond)
+
+			target.mu.Lock()
+			defer target.mu.Unlock()
+			if n := len(target.received); n < tt.min || n > tt.max {
+				t.Errorf("%d of %d requests mirrored, want between %d and %d", n, tt.requests, tt.min, tt.max)
+			}
+			for _, got := range target.received {
+				if want := "POST /shadow/api?ops=2 payload"; got != want {
+					t.Errorf("mirror received %q, want %q", got, want)
+					break
+				}
+			}
+		})
+	}
+}
+
+// With every slot busy, further copies are dropped rather than queued
+func TestMirrorDropsWhenBusy(t *testing.T) {
+	target := newMirrorTarget(t)
+	target.release = make(chan struct{})
+	m, err := newMirror(target.URL, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setVar(t, &apiMirror, m)
+	h := mirrored(func(w http.ResponseWriter, r *http.Request) {})
+
+	dropped := metricValue(t, mirrorRequestsTotal.WithLabelValues("dropped"))
+	sent := metricValue(t, mirrorRequestsTotal.WithLabelValues("sent"))
+	for i := 0; i < 5; i++ {
+		start := time.Now()
+		h(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api", nil))
+		if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+			t.Errorf("request %d waited %s on the mirror", i+1, elapsed)
+		}
+	}
+	if got := metricValue(t, mirrorRequestsTotal.WithLabelValues("dropped")) - dropped; got != 3 {
+		t.Errorf("%g copies dropped, want 3", got)
+	}
+
+	close(target.release)
+	before := mirrorResults(t)
+	waitMirrored(t, before, 2)
+	if got := metricValue(t, mirrorRequestsTotal.WithLabelValues("sent")) - sent; got != 2 {
+		t.Errorf("%g copies sent, want 2", got)
+	}
+}
+
+func TestNewMirror(t *testing.T) {
+	tests := []struct {
+		target      string
+		fraction    float64
+		concurrency int
+		ok          bool
+	}{
+		{"http://shadow:8080", 0.1, 10, true},
+		{"https://shadow/base", 1, 1, true},
+		{"shadow:8080", 0.1, 10, false},
+		{"ftp://shadow", 0.1, 10, false},
+		{"http://shadow", 1.5, 10, false},
+		{"http://shadow", -0.1, 10, false},
+		{"http://shadow", 0.1, 0, false},
+	}
+	for _, tt := range tests {
+		_, err := newMirror(tt.target, tt.fraction, tt.concurrency)
+		if (err == nil) != tt.ok {
+			t.Errorf("newMirror(%q, %g, %d): error %v, want ok %v", tt.target, tt.fraction, tt.concurrency, err, tt.ok)
+		}
+	}
+}
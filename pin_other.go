@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// CPU affinity is only supported on Linux; elsewhere workers always float
+func pinToCPU(cpu int) error {
+	return errors.New("CPU pinning is only supported on Linux")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Histogram for outbound /proxy call latency
+	proxyRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "proxy_request_duration_seconds",
+			Help:    "Latency of outbound /proxy requests in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"host"},
+	)
+
+	// Hosts (host or host:port) /proxy may call, from PROXY_ALLOWLIST
+	proxyAllowlist []string
+
+	// Client for /proxy; redirects are only followed to allowlisted hosts
+	proxyClient = &http.Client{
+		Timeout: 5 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return checkProxyTarget(req.URL)
+		},
+	}
+)
+
+// Parse a comma-separated allowlist of hosts, lowercased
+func parseAllowlist(value string) []string {
+	var hosts []string
+	for _, h := range strings.Split(value, ",") {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// Allow only http(s) URLs whose host, with or without port, is allowlisted
+func checkProxyTarget(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme %q not allowed", u.Scheme)
+	}
+	host := strings.ToLower(u.Host)
+	if slices.Contains(proxyAllowlist, host) || slices.Contains(proxyAllowlist, strings.ToLower(u.Hostname())) {
+		return nil
+	}
+	return fmt.Errorf("host %q not in allowlist", u.Host)
+}
+
+// Server-side GET of an allowlisted URL: /proxy?url=http://backend:8080/path
+func proxyHandler(w http.ResponseWriter, r *http.Request) {
+	target, err := url.Parse(r.URL.Query().Get("url"))
+	if err != nil || target.Host == "" {
+		writeJSONError(w, http.StatusBadRequest, "url must be an absolute http(s) URL")
+		return
+	}
+	if err := checkProxyTarget(target); err != nil {
+		writeJSONError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, target.String(), nil)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	start := time.Now()
+	resp, err := proxyClient.Do(req)
+	if err != nil {
+		proxyRequestDuration.WithLabelValues(target.Host).Observe(secondsSince(start))
+		writeJSONError(w, http.StatusBadGateway, "proxy request failed: "+err.Error())
+		return
+	}
+	size, err := io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	duration := time.Since(start)
+	proxyRequestDuration.WithLabelValues(target.Host).Observe(duration.Seconds())
+	if err != nil {
+		writeJSONError(w, http.StatusBadGateway, "reading proxy response failed: "+err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"url":      target.String(),
+		"status":   resp.StatusCode,
+		"bytes":    size,
+		"duration": duration.String(),
+	})
+}
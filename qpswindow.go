@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+// Largest QPS averaging window in seconds
+const maxQPSWindow = 300
+
+// Seconds http_requests_per_second is averaged over, from QPS_WINDOW and
+// adjustable at runtime through /admin/qps-window
+var qpsWindow atomic.Int64
+
+func init() {
+	qpsWindow.Store(1)
+}
+
+// Parse and bounds-check a QPS window in seconds
+func parseQPSWindow(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > maxQPSWindow {
+		return 0, fmt.Errorf("seconds must be an integer between 1 and %d", maxQPSWindow)
+	}
+	return n, nil
+}
+
+// Report (GET) or update (POST/PUT ?seconds=10) the QPS averaging window.
+// A longer window fills up over the following seconds; a shorter one applies
+// on the next tick.
+func adminQPSWindowHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		n, err := parseQPSWindow(r.URL.Query().Get("seconds"))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		qpsWindow.Store(int64(n))
+		events.add(eventSettingChanged, "QPS window changed", "seconds", n)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int64{
+		"seconds": qpsWindow.Load(),
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestAdminQPSWindow(t *testing.T) {
+	setAtomic(t, &qpsWindow, 1)
+	tests := []struct {
+		method, target string
+		status         int
+		seconds        int64 // afterwards
+	}{
+		{http.MethodGet, "/admin/qps-window", http.StatusOK, 1},
+		{http.MethodPost, "/admin/qps-window?seconds=10", http.StatusOK, 10},
+		{http.MethodPut, "/admin/qps-window?seconds=300", http.StatusOK, 300},
+		{http.MethodPost, "/admin/qps-window?seconds=0", http.StatusBadRequest, 300},
+		{http.MethodPost, "/admin/qps-window?seconds=301", http.StatusBadRequest, 300},
+		{http.MethodPost, "/admin/qps-window?seconds=ten", http.StatusBadRequest, 300},
+		{http.MethodPost, "/admin/qps-window", http.StatusBadRequest, 300},
+	}
+	for _, tt := range tests {
+		rec := serve(http.HandlerFunc(adminQPSWindowHandler), tt.method, tt.target)
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.target, rec.Code, tt.status)
+		}
+		if rec.Code == http.StatusOK {
+			var body struct{ Seconds int64 }
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Seconds != tt.seconds {
+				t.Errorf("%s %s: body %s, want seconds %d", tt.method, tt.target, rec.Body, tt.seconds)
+			}
+		}
+		if got := qpsWindow.Load(); got != tt.seconds {
+			t.Errorf("%s %s: window %d, want %d", tt.method, tt.target, got, tt.seconds)
+		}
+	}
+}
+
+// The next ticks average over a window changed at runtime; a longer one fills
+// up over the following seconds
+func TestQPSWindowChangeApplies(t *testing.T) {
+	setAtomic(t, &qpsWindow, 1)
+	setVar(t, &requestCounter, 0)
+	c := newQPSCalculator(prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_duration_seconds"}))
+
+	tests := []struct {
+		window   string // set before the tick
+		requests uint64
+		qps      float64
+	}{
+		{"", 10, 10},
+		{"", 20, 20},
+		{"3", 30, 25},     // 50 over the 2s sampled so far
+		{"", 0, 50.0 / 3}, // full 3s window
+		{"", 60, 30},      // 90 over 3s
+		{"1", 6, 6},       // shrinks on the next tick
+	}
+	for i, tt := range tests {
+		if tt.window != "" {
+			rec := serve(http.HandlerFunc(adminQPSWindowHandler), http.MethodPost, "/admin/qps-window?seconds="+tt.window)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("set window %s: status %d", tt.window, rec.Code)
+			}
+		}
+		atomic.AddUint64(&requestCounter, tt.requests)
+		c.tick()
+		if got := metricValue(t, currentQPS); math.Abs(got-tt.qps) > 1e-9 {
+			t.Errorf("tick %d: qps %g, want %g", i+1, got, tt.qps)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Counter for requests rejected by the per-client rate limit
+	ipRateLimitedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ip_rate_limited_total",
+			Help: "Total number of requests rejected with 429 by the per-client-IP rate limit",
+		},
+	)
+
+	// Per-client-IP token buckets, from IP_RATE_LIMIT; nil disables the limit
+	ipLimiter *clientRateLimiter
+)
+
+// Token bucket per client IP. A bucket idle long enough to have refilled is
+// indistinguishable from a new one, so sweeping those loses nothing and
+// bounds memory to the clients active within one refill time.
+type clientRateLimiter struct {
+	rate  float64 // tokens per second
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newClientRateLimiter(rate float64, burst int) *clientRateLimiter {
+	return &clientRateLimiter{rate: rate, burst: float64(burst), buckets: map[string]*tokenBucket{}}
+}
+
+// Take a token from ip's bucket, or report false when it is empty
+func (l *clientRateLimiter) allow(ip string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[ip]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[ip] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Time for an empty bucket to fill up again
+func (l *clientRateLimiter) refillTime() time.Duration {
+	return time.Duration(l.burst / l.rate * float64(time.Second))
+}
+
+// Drop buckets that have been idle for at least a full refill
+func (l *clientRateLimiter) sweep(now time.Time) {
+	idle := l.refillTime()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for ip, b := range l.buckets {
+		if now.Sub(b.last) >= idle {
+			delete(l.buckets, ip)
+		}
+	}
+}
+
+// Sweep idle buckets periodically until ctx is done
+func (l *clientRateLimiter) run(ctx context.Context) {
+	interval := max(l.refillTime(), time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	hb := newHeartbeat("ip_rate_limit", interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			hb.beat()
+			l.sweep(now)
+		}
+	}
+}
+
+// Reject requests with 429 once their client IP exceeds its rate
+func rateLimitByIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l := ipLimiter; l != nil && !l.allow(clientIP(r), time.Now()) {
+			ipRateLimitedTotal.Inc()
+			writeShed(w, http.StatusTooManyRequests, "rate_limited", "client rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientRateLimiterAllow(t *testing.T) {
+	l := newClientRateLimiter(2, 3)
+	start := time.Now()
+
+	tests := []struct {
+		ip    string
+		at    time.Duration
+		allow bool
+	}{
+		{"10.0.0.1", 0, true},
+		{"10.0.0.1", 0, true},
+		{"10.0.0.1", 0, true},
+		{"10.0.0.1", 0, false}, // burst used up
+		{"10.0.0.2", 0, true},  // other clients have their own bucket
+		{"10.0.0.1", 250 * time.Millisecond, false},
+		{"10.0.0.1", 500 * time.Millisecond, true}, // one token back at 2/s
+		{"10.0.0.1", 500 * time.Millisecond, false},
+		// Idle time refills up to the burst, not past it
+		{"10.0.0.1", 10 * time.Second, true},
+		{"10.0.0.1", 10 * time.Second, true},
+		{"10.0.0.1", 10 * time.Second, true},
+		{"10.0.0.1", 10 * time.Second, false},
+	}
+	for i, tt := range tests {
+		if got := l.allow(tt.ip, start.Add(tt.at)); got != tt.allow {
+			t.Errorf("request %d from %s at %s: allow = %v, want %v", i+1, tt.ip, tt.at, got, tt.allow)
+		}
+	}
+}
+
+// Only buckets idle for a full refill are swept
+func TestClientRateLimiterSweep(t *testing.T) {
+	l := newClientRateLimiter(2, 4) // refills in 2s
+	start := time.Now()
+	l.allow("idle", start)
+	l.allow("recent", start.Add(time.Second))
+
+	tests := []struct {
+		at   time.Duration
+		left []string
+	}{
+		{time.Second, []string{"idle", "recent"}},
+		{2 * time.Second, []string{"recent"}},
+		{3 * time.Second, nil},
+	}
+	for _, tt := range tests {
+		l.sweep(start.Add(tt.at))
+		if len(l.buckets) != len(tt.left) {
+			t.Errorf("after sweep at %s: %d buckets, want %v", tt.at, len(l.buckets), tt.left)
+		}
+		for _, ip := range tt.left {
+			if _, ok := l.buckets[ip]; !ok {
+				t.Errorf("after sweep at %s: bucket %s swept", tt.at, ip)
+			}
+		}
+	}
+}
+
+func TestRateLimitByIP(t *testing.T) {
+	setVar(t, &ipLimiter, newClientRateLimiter(0.001, 2))
+	h := rateLimitByIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		remoteAddr string
+		status     int
+	}{
+		{"192.0.2.1:1000", http.StatusOK},
+		{"192.0.2.1:1001", http.StatusOK}, // same client on a new connection
+		{"192.0.2.1:1002", http.StatusTooManyRequests},
+		{"192.0.2.2:1000", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api", nil)
+		req.RemoteAddr = tt.remoteAddr
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.remoteAddr, rec.Code, tt.status)
+		}
+		if rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: 429 without Retry-After", tt.remoteAddr)
+		}
+	}
+
+	setVar(t, &ipLimiter, nil)
+	for i := 0; i < 5; i++ {
+		if rec := serve(h, http.MethodGet, "/api"); rec.Code != http.StatusOK {
+			t.Fatalf("no limit: status %d", rec.Code)
+		}
+	}
+}
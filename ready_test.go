@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Each failing readiness gate shows up in the 503 body, the first one as
+// the reason and all of them as the reasons
+func TestReadyReasons(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(up.Close)
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(down.Close)
+
+	fullPool := newWorkerPool(1, 1)
+	fullPool.jobs <- poolJob{}
+
+	tests := []struct {
+		name      string
+		starting  bool
+		draining  bool
+		served    uint64
+		deps      []string
+		pool      *workerPool
+		reasons   []string
+		failedDep string
+	}{
+		{name: "ready", served: 5, deps: []string{up.URL}, pool: newWorkerPool(1, 1)},
+		{name: "starting", starting: true, served: 5, reasons: []string{"starting"}},
+		// Shutdown clears ready too, but is reported only as draining
+		{name: "draining", starting: true, draining: true, served: 5, reasons: []string{"draining"}},
+		{name: "warming up", served: 4, reasons: []string{"warming_up"}},
+		{name: "dependency down", served: 5, deps: []string{up.URL, down.URL}, reasons: []string{"dependencies_down"}, failedDep: down.URL},
+		{name: "overloaded", served: 5, pool: fullPool, reasons: []string{"overloaded"}},
+		{
+			name:      "every gate",
+			starting:  true,
+			deps:      []string{down.URL},
+			pool:      fullPool,
+			reasons:   []string{"starting", "warming_up", "dependencies_down", "overloaded"},
+			failedDep: down.URL,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setBool(t, &ready, !tt.starting)
+			setBool(t, &shuttingDown, tt.draining)
+			setVar(t, &readyMinRequests, 5)
+			setVar(t, &warmupCounter, tt.served)
+			setVar(t, &apiPool, tt.pool)
+			var deps *depChecker
+			if tt.deps != nil {
+				var err error
+				if deps, err = newDepChecker(tt.deps, time.Second, 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+			setVar(t, &readinessDeps, deps)
+
+			rec := serve(http.HandlerFunc(readyHandler), http.MethodGet, readyPath)
+			if tt.reasons == nil {
+				if rec.Code != http.StatusOK {
+					t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+				}
+				return
+			}
+			if rec.Code != http.StatusServiceUnavailable {
+				t.Fatalf("status = %d, want 503", rec.Code)
+			}
+			if rec.Header().Get("Retry-After") == "" {
+				t.Error("missing Retry-After")
+			}
+			var body errorEnvelope
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if body.Error.Reason != tt.reasons[0] {
+				t.Errorf("reason = %q, want %q", body.Error.Reason, tt.reasons[0])
+			}
+			if !reflect.DeepEqual(body.Error.Reasons, tt.reasons) {
+				t.Errorf("reasons = %q, want %q", body.Error.Reasons, tt.reasons)
+			}
+			if tt.failedDep != "" {
+				if _, ok := body.Error.Details[tt.failedDep]; !ok || len(body.Error.Details) != 1 {
+					t.Errorf("details = %v, want only %s", body.Error.Details, tt.failedDep)
+				}
+			}
+		})
+	}
+}
+
+// Readiness holds until READY_MIN_REQUESTS successful app requests were
+// served; probes and server errors do not count
+func TestReadyAfterWarmup(t *testing.T) {
+	setBool(t, &ready, true)
+	setBool(t, &shuttingDown, false)
+	setVar(t, &readyMinRequests, 3)
+	setVar(t, &warmupCounter, 0)
+	setVar(t, &readinessDeps, nil)
+	setVar(t, &apiPool, nil)
+	setAtomic(t, &apiLatency, 0)
+	rt := newTestRouter(t)
+	failing := metricsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	tests := []struct {
+		handler http.Handler
+		target  string
+		ready   bool // afterwards
+	}{
+		{rt, healthPath, false},
+		{rt, readyPath, false},
+		{rt, "/api", false},
+		{failing, "/api", false},
+		{rt, "/uptime", false},
+		{rt, "/api", true},
+		{rt, "/api", true},
+	}
+	for i, tt := range tests {
+		serve(tt.handler, http.MethodGet, tt.target)
+		rec := serve(http.HandlerFunc(readyHandler), http.MethodGet, readyPath)
+		if got := rec.Code == http.StatusOK; got != tt.ready {
+			t.Errorf("after request %d to %s: ready %v, want %v: %s", i+1, tt.target, got, tt.ready, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var (
+	// Dependencies /ready requires to be up, from READINESS_DEPS; nil checks none
+	readinessDeps *depChecker
+
+	// Client for readiness dependency probes; the timeout is per check
+	readinessClient = &http.Client{}
+)
+
+// Probes readiness dependencies and caches the outcome so frequent probes
+// do not turn into a load on the dependencies
+type depChecker struct {
+	urls    []string
+	timeout time.Duration
+	ttl     time.Duration
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	// Error by URL of the dependencies that were down at the last check
+	failing map[string]string
+}
+
+func newDepChecker(urls []string, timeout, ttl time.Duration) (*depChecker, error) {
+	if timeout <= 0 || ttl < 0 {
+		return nil, fmt.Errorf("probe timeout must be positive and cache lifetime >= 0")
+	}
+	for _, u := range urls {
+		parsed, err := url.Parse(u)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("dependency %q must be an absolute http(s) URL", u)
+		}
+	}
+	return &depChecker{urls: urls, timeout: timeout, ttl: ttl}, nil
+}
+
+// Failing dependencies, probing them again once the cached result expires
+func (c *depChecker) check(ctx context.Context) map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.checkedAt) < c.ttl {
+		return c.failing
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failing := map[string]string{}
+	for _, u := range c.urls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := probeDependency(ctx, u); err != nil {
+				mu.Lock()
+				failing[u] = err.Error()
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// A probe cut short by the caller going away says nothing about the
+	// dependency, so leave the previous result in place
+	if ctx.Err() != nil && context.Cause(ctx) == context.Canceled {
+		return failing
+	}
+	c.failing = failing
+	c.checkedAt = time.Now()
+	return failing
+}
+
+// A dependency is up when it answers with a status below 400
+func probeDependency(ctx context.Context, u string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := readinessClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
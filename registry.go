@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/common/model"
+)
+
+var (
+	// Registry served on /metrics and pushed on shutdown
+	metricsRegistry = prometheus.NewRegistry()
+
+	// Registerer adding the METRICS_CONST_LABELS and ENV_LABEL to every
+	// metric, set by setupMetrics
+	metricsRegisterer prometheus.Registerer = metricsRegistry
+)
+
+// Wrap the registry with the configured constant labels and register all metrics
+func setupMetrics() error {
+	labels, err := parseConstLabels(os.Getenv("METRICS_CONST_LABELS"))
+	if err != nil {
+		return fmt.Errorf("invalid METRICS_CONST_LABELS: %w", err)
+	}
+	if err := addEnvLabel(labels, os.Getenv("ENV_LABEL")); err != nil {
+		return fmt.Errorf("invalid ENV_LABEL: %w", err)
+	}
+	metricsRegisterer = prometheus.WrapRegistererWith(labels, metricsRegistry)
+	return registerMetrics(metricsRegisterer)
+}
+
+// Log the metric families the registry currently exposes, to confirm which
+// optional metrics are active. Vecs show up only once they have a series,
+// so families keyed by path or result may appear after the first request.
+func logRegisteredMetrics() {
+	families, err := metricsRegistry.Gather()
+	if err != nil {
+		log.Printf("Failed to gather registered metrics: %v", err)
+	}
+	names := make([]string, len(families))
+	for i, mf := range families {
+		names[i] = mf.GetName()
+	}
+	log.Printf("Exposing %d metric families: %s", len(names), strings.Join(names, ", "))
+}
+
+// Register every application metric. A collector that is already registered
+// is replaced by the existing one, so registering twice is harmless; any
+// other failure is returned for main to report.
+func registerMetrics(reg prometheus.Registerer) error {
+	// Standard Go runtime and process metrics, as on the default registry
+	goCollector := collectors.NewGoCollector()
+	processCollector := collectors.NewProcessCollector(collectors.ProcessCollectorOpts{})
+
+	return errors.Join(
+		register(reg, &goCollector),
+		register(reg, &processCollector),
+
+		register(reg, &httpRequestsTotal),
+		register(reg, &httpRequestsByProtocol),
+		register(reg, &requestCostTotal),
+		register(reg, &requestCostPerSecond),
+		register(reg, &currentQPS),
+		register(reg, &smoothedQPS),
+		register(reg, &recommendedReplicas),
+		register(reg, &httpRequestsInFlight),
+		register(reg, &goroutineChurn),
+		register(reg, &retainedMemoryBytes),
+		register(reg, &gcPressureAllocRate),
+		register(reg, &acceptToHandler),
+		register(reg, &connIdleTimeoutsTotal),
+		register(reg, &connIdleClosedTotal),
+		register(reg, &httpRequestDuration),
+		register(reg, &httpTimeToFirstByte),
+		register(reg, &httpRequestCPURatio),
+		register(reg, &handlerGoroutineDelta),
+		register(reg, &httpRequestSize),
+		register(reg, &httpCacheRequestsTotal),
+		register(reg, &httpErrorRatio),
+		register(reg, &httpErrorRate),
+		register(reg, &httpErrorRatioBreached),
+		register(reg, &latencySLOBurnRate),
+		register(reg, &httpPanicsTotal),
+		register(reg, &httpAbortedTotal),
+		register(reg, &handlerWorkDuration),
+		register(reg, &apiEffectiveLatency),
+		register(reg, &distinctClientsGauge),
+
+		register(reg, &burnActive),
+		register(reg, &burnRejectedTotal),
+		register(reg, &singleflightSharedTotal),
+		register(reg, &coalescedRequestsTotal),
+		register(reg, &concurrencyLimitGauge),
+		register(reg, &concurrencyLimitedTotal),
+		register(reg, &ipRateLimitedTotal),
+		register(reg, &downstreamDuration),
+		register(reg, &dependencyCallDuration),
+		register(reg, &circuitBreakerState),
+		register(reg, &workerPoolUtilization),
+		register(reg, &workerPoolQueueDepth),
+		register(reg, &workerQueueWait),
+		register(reg, &workerPoolRejectedTotal),
+		register(reg, &dbPoolBusy),
+		register(reg, &dbPoolWaiters),
+		register(reg, &dbPoolTimeoutsTotal),
+		register(reg, &proxyRequestDuration),
+		register(reg, &mirrorRequestsTotal),
+		register(reg, &metricsUnauthorizedTotal),
+		register(reg, &metricsScrapeInterval),
+		register(reg, &configReloadsTotal),
+		register(reg, &configReloadErrorsTotal),
+		register(reg, &configLastReloadTimestamp),
+
+		register(reg, &selfLoadRequestsTotal),
+		register(reg, &selfLoadErrorsTotal),
+		register(reg, &selfLoadConnectionsTotal),
+	)
+}
+
+// Register *c, or point *c at the collector already registered under the same descriptor
+func register[T prometheus.Collector](reg prometheus.Registerer, c *T) error {
+	err := reg.Register(*c)
+	if err == nil {
+		return nil
+	}
+
+	var already prometheus.AlreadyRegisteredError
+	if !errors.As(err, &already) {
+		return err
+	}
+	existing, ok := already.ExistingCollector.(T)
+	if !ok {
+		return fmt.Errorf("collector already registered with a different type %T: %w", already.ExistingCollector, err)
+	}
+	*c = existing
+	return nil
+}
+
+// Parse constant labels such as "service=scaling-poc,env=staging,region=us-west".
+// Names must be valid Prometheus label names and not reserved ("__" prefix).
+func parseConstLabels(value string) (prometheus.Labels, error) {
+	labels := prometheus.Labels{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, val, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok {
+			return nil, fmt.Errorf("label %q: expected name=value", pair)
+		}
+		if !model.LabelName(name).IsValid() || strings.HasPrefix(name, model.ReservedLabelPrefix) {
+			return nil, fmt.Errorf("label %q: invalid label name", name)
+		}
+		if _, dup := labels[name]; dup {
+			return nil, fmt.Errorf("label %q: set more than once", name)
+		}
+		labels[name] = strings.TrimSpace(val)
+	}
+	return labels, nil
+}
+
+// Add env=value for ENV_LABEL, e.g. ENV_LABEL=staging; empty adds nothing
+func addEnvLabel(labels prometheus.Labels, value string) error {
+	if value == "" {
+		return nil
+	}
+	if !model.LabelValue(value).IsValid() {
+		return fmt.Errorf("%q is not a valid label value", value)
+	}
+	if _, dup := labels["env"]; dup {
+		return errors.New("env is already set in METRICS_CONST_LABELS")
+	}
+	labels["env"] = value
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Serve /metrics from a fresh registry for the rest of the test
+func useTestRegistry(t *testing.T) {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	setVar(t, &metricsRegistry, reg)
+	setVar(t, &metricsRegisterer, prometheus.Registerer(reg))
+}
+
+func TestParseConstLabels(t *testing.T) {
+	tests := []struct {
+		value  string
+		env    string
+		labels prometheus.Labels // nil for an error
+	}{
+		{"", "", prometheus.Labels{}},
+		{"service=scaling-poc, region = us-west ,", "", prometheus.Labels{"service": "scaling-poc", "region": "us-west"}},
+		{"service=scaling-poc", "staging", prometheus.Labels{"service": "scaling-poc", "env": "staging"}},
+		{"team=", "", prometheus.Labels{"team": ""}},
+		{"service", "", nil},
+		{"1service=x", "", nil},
+		{"__name__=x", "", nil},
+		{"a=1,a=2", "", nil},
+		{"env=prod", "staging", nil},
+		{"", "\xff", nil},
+	}
+	for _, tt := range tests {
+		labels, err := parseConstLabels(tt.value)
+		if err == nil {
+			err = addEnvLabel(labels, tt.env)
+		}
+		if tt.labels == nil {
+			if err == nil {
+				t.Errorf("%q, ENV_LABEL %q: labels %v, want an error", tt.value, tt.env, labels)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(labels, tt.labels) {
+			t.Errorf("%q, ENV_LABEL %q: labels %v, error %v, want %v", tt.value, tt.env, labels, err, tt.labels)
+		}
+	}
+}
+
+// Constant labels from the environment appear on every scraped series
+func TestConstLabelsScraped(t *testing.T) {
+	useTestRegistry(t)
+	t.Setenv("METRICS_CONST_LABELS", "service=scaling-poc,region=us-west")
+	t.Setenv("ENV_LABEL", "staging")
+	if err := setupMetrics(); err != nil {
+		t.Fatalf("setupMetrics: %v", err)
+	}
+	serve(metricsMiddleware(func(w http.ResponseWriter, r *http.Request) {}), http.MethodGet, "/labelled")
+
+	rec := serve(newMetricsHandler(), http.MethodGet, "/metrics")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("scrape status %d", rec.Code)
+	}
+	scraped := false
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if strings.HasPrefix(line, "#") || line == "" {
+			continue
+		}
+		for _, want := range []string{`env="staging"`, `region="us-west"`, `service="scaling-poc"`} {
+			if !strings.Contains(line, want) {
+				t.Errorf("series without %s: %s", want, line)
+			}
+		}
+		if strings.HasPrefix(line, "http_requests_total{") && strings.Contains(line, `path="/labelled"`) {
+			scraped = true
+		}
+	}
+	if !scraped {
+		t.Errorf("http_requests_total for /labelled not scraped:\n%s", rec.Body)
+	}
+}
+
+// Registering twice reuses the collectors already registered instead of failing
+func TestRegisterMetricsTwice(t *testing.T) {
+	useTestRegistry(t)
+	if err := registerMetrics(metricsRegisterer); err != nil {
+		t.Fatalf("first registration: %v", err)
+	}
+	if err := registerMetrics(metricsRegisterer); err != nil {
+		t.Fatalf("second registration: %v", err)
+	}
+
+	// A different collector under a registered name is still an error
+	clash := prometheus.NewGauge(prometheus.GaugeOpts{Name: "http_requests_total", Help: "clash"})
+	if err := register(metricsRegisterer, &clash); err == nil {
+		t.Error("clashing collector registered")
+	}
+
+	// A copy of a registered collector is pointed at the registered one
+	c := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_reused_total", Help: "reused"})
+	if err := register(metricsRegisterer, &c); err != nil {
+		t.Fatal(err)
+	}
+	again := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_reused_total", Help: "reused"})
+	if err := register(metricsRegisterer, &again); err != nil {
+		t.Fatalf("re-registration: %v", err)
+	}
+	if again != c {
+		t.Error("re-registration did not reuse the existing collector")
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Counter for successful reloads on SIGHUP or file change
+	configReloadsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "config_reloads_total",
+			Help: "Total number of successful configuration reloads",
+		},
+	)
+
+	// Counter for failed reloads; the previous configuration stays in effect
+	configReloadErrorsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "config_reload_errors_total",
+			Help: "Total number of failed configuration reloads",
+		},
+	)
+
+	// Gauge for when the configuration was last reloaded successfully
+	configLastReloadTimestamp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "config_last_reload_timestamp_seconds",
+			Help: "Unix time of the last successful configuration reload",
+		},
+	)
+)
+
+// Record the outcome of a reload
+func recordReload(err error) {
+	if err != nil {
+		configReloadErrorsTotal.Inc()
+		return
+	}
+	configReloadsTotal.Inc()
+	configLastReloadTimestamp.Set(float64(time.Now().UnixNano()) / float64(time.Second))
+}
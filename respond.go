@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// Error envelope shared by all error responses
+type errorEnvelope struct {
+	Error errorBody `json:"error"`
+}
+
+type errorBody struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	// Machine-readable cause for shed requests, such as "draining"
+	Reason string `json:"reason,omitempty"`
+	// Every failing cause when several apply at once, such as failed readiness gates
+	Reasons []string `json:"reasons,omitempty"`
+	// Per-item causes, such as the error of each failing dependency
+	Details map[string]string `json:"details,omitempty"`
+}
+
+var (
+	// Seconds clients are told to wait via Retry-After on 503 responses
+	retryAfterSeconds = 5
+
+	// Body and content type of load-shedding responses, from SHED_RESPONSE_BODY
+	// and SHED_RESPONSE_CONTENT_TYPE; an empty body keeps the error envelope
+	shedResponseBody        string
+	shedResponseContentType = "text/plain; charset=utf-8"
+)
+
+// Write v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Failed to encode response: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to encode response")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// Write a {"error":{"code":...,"message":...}} envelope with the given status code
+func writeJSONError(w http.ResponseWriter, code int, message string) {
+	writeErrorBody(w, errorBody{Code: code, Message: message})
+}
+
+// Status for a request the client abandoned, borrowed from nginx
+const statusClientClosedRequest = 499
+
+// Record a request the client gave up on as a 499, so the HTTP metrics count
+// it as neither a success nor a server error. The client is gone, so no body
+// is sent.
+func writeClientClosed(w http.ResponseWriter) {
+	w.WriteHeader(statusClientClosedRequest)
+}
+
+// Write a 503 with a Retry-After header and the reason in the envelope
+func writeUnavailable(w http.ResponseWriter, reason, message string) {
+	writeShed(w, http.StatusServiceUnavailable, reason, message)
+}
+
+// Reject a request to shed load, with Retry-After and either the configured
+// shed body or the error envelope
+func writeShed(w http.ResponseWriter, code int, reason, message string) {
+	events.add(eventRequestShed, "Request shed", "reason", reason, "status", code)
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+	if shedResponseBody == "" {
+		writeErrorBody(w, errorBody{Code: code, Message: message, Reason: reason})
+		return
+	}
+	w.Header().Set("Content-Type", shedResponseContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	w.Write([]byte(shedResponseBody))
+}
+
+func writeErrorBody(w http.ResponseWriter, e errorBody) {
+	body, _ := json.Marshal(errorEnvelope{Error: e})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Code)
+	w.Write(body)
+}
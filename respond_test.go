@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Error paths across handlers share one envelope
+func TestErrorEnvelope(t *testing.T) {
+	setVar(t, &adminToken, "")
+	rt := newTestRouter(t)
+
+	tests := []struct {
+		method, target string
+		status         int
+	}{
+		{http.MethodGet, "/nowhere", http.StatusNotFound},
+		{http.MethodDelete, "/api", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api?ops=0", http.StatusBadRequest},
+		{http.MethodGet, "/burn?duration=1h", http.StatusBadRequest},
+		{http.MethodGet, "/admin/events?limit=-1", http.StatusBadRequest},
+		{http.MethodGet, "/admin/panic", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		rec := serve(rt, tt.method, tt.target)
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.target, rec.Code, tt.status)
+			continue
+		}
+		if got := rec.Header().Get("Content-Type"); got != "application/json" {
+			t.Errorf("%s %s: Content-Type %q, want application/json", tt.method, tt.target, got)
+		}
+		var body map[string]map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s %s: body %q is not an envelope: %v", tt.method, tt.target, rec.Body, err)
+			continue
+		}
+		e, ok := body["error"]
+		if !ok || len(body) != 1 {
+			t.Errorf("%s %s: body %q, want only an error object", tt.method, tt.target, rec.Body)
+			continue
+		}
+		if code, _ := e["code"].(float64); int(code) != tt.status {
+			t.Errorf("%s %s: error code %v, want %d", tt.method, tt.target, e["code"], tt.status)
+		}
+		if msg, _ := e["message"].(string); msg == "" {
+			t.Errorf("%s %s: empty error message", tt.method, tt.target)
+		}
+	}
+}
+
+// The metrics wrapper sees the status the helpers write
+func TestWriteJSONStatusRecorded(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(w http.ResponseWriter)
+		code  int
+	}{
+		{"error", func(w http.ResponseWriter) { writeJSONError(w, http.StatusConflict, "conflict") }, http.StatusConflict},
+		{"success", func(w http.ResponseWriter) { writeJSON(w, http.StatusCreated, map[string]string{"status": "ok"}) }, http.StatusCreated},
+		{"unencodable", func(w http.ResponseWriter) { writeJSON(w, http.StatusOK, func() {}) }, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		rw := &responseWriter{ResponseWriter: rec, statusCode: http.StatusOK}
+		tt.write(rw)
+		if rw.statusCode != tt.code || rec.Code != tt.code {
+			t.Errorf("%s: recorded %d, sent %d, want %d", tt.name, rw.statusCode, rec.Code, tt.code)
+		}
+		if got := rec.Header().Get("Content-Type"); got != "application/json" {
+			t.Errorf("%s: Content-Type %q, want application/json", tt.name, got)
+		}
+	}
+}
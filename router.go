@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// A registered route, as reported by /admin/routes
+type route struct {
+	Path          string   `json:"path"`
+	Methods       []string `json:"methods"`
+	BypassMetrics bool     `json:"bypass_metrics"`
+}
+
+// Router wraps a ServeMux and records every registration so routes can be
+// listed and duplicates reported instead of panicking inside the mux
+type router struct {
+	mux    *http.ServeMux
+	routes []route
+	errs   []error
+
+	// Runtime switches by path, set through /admin/endpoints
+	toggles map[string]*endpointToggle
+}
+
+// Register a handler wrapped in metricsMiddleware; no methods means any method
+func (rt *router) handle(path string, methods []string, h http.HandlerFunc) {
+	rt.register(path, methods, false, h)
+}
+
+// Register a handler that is not counted in the HTTP metrics
+func (rt *router) handleBypass(path string, methods []string, h http.Handler) {
+	rt.register(path, methods, true, h)
+}
+
+func (rt *router) register(path string, methods []string, bypass bool, h http.Handler) {
+	for _, existing := range rt.routes {
+		if existing.Path == path {
+			rt.errs = append(rt.errs, fmt.Errorf("route %q registered more than once", path))
+			return
+		}
+	}
+	rt.routes = append(rt.routes, route{Path: path, Methods: methods, BypassMetrics: bypass})
+
+	// The latency override sits inside the cache so hits skip it, like the
+	// handler's own simulated latency; overrides only exist on toggleable paths
+	h = cached(path, delayed(path, h))
+	if toggleable(path) {
+		t := &endpointToggle{}
+		rt.toggles[path] = t
+		h = t.wrap(h)
+	}
+	h = recoverMiddleware(allowMethods(methods, h))
+	if !bypass && !isProbePath(path) && !strings.HasPrefix(path, "/admin/") {
+		h = rejectWhenDraining(rateLimitByIP(h))
+	}
+	if !bypass {
+		h = metricsMiddleware(measureCPURatio(sampleGoroutineDelta(h.ServeHTTP)))
+	}
+	if !bypass && toggleable(path) {
+		h = abortRandomly(h)
+	}
+	h = closeWhenDraining(h)
+	if err := rt.muxHandle(path, h); err != nil {
+		rt.errs = append(rt.errs, err)
+	}
+}
+
+// ServeMux panics on invalid or conflicting patterns; report that as an error
+func (rt *router) muxHandle(path string, h http.Handler) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("route %q: %v", path, p)
+		}
+	}()
+	rt.mux.Handle(path, h)
+	return nil
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
+
+// Reject methods outside the allowed set with 405; HEAD is allowed wherever GET is
+func allowMethods(methods []string, next http.Handler) http.Handler {
+	if len(methods) == 0 {
+		return next
+	}
+	allow := strings.Join(methods, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := r.Method
+		if method == http.MethodHead {
+			method = http.MethodGet
+		}
+		if !slices.Contains(methods, method) {
+			w.Header().Set("Allow", allow)
+			writeJSONError(w, http.StatusMethodNotAllowed, "method "+r.Method+" not allowed")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Build the router with all application routes; fails if a path is
+// registered twice, e.g. when HEALTH_PATH or READY_PATH collides with a route
+func newRouter() (*router, error) {
+	rt := &router{mux: http.NewServeMux(), toggles: map[string]*endpointToggle{}}
+
+	get := []string{http.MethodGet}
+	getPost := []string{http.MethodGet, http.MethodPost}
+
+	rt.handle("/", get, rootHandler)
+	rt.handle(healthPath, get, healthHandler)
+	if healthPath != "/healthz" {
+		rt.handle("/healthz", get, healthHandler)
+	}
+	rt.handle(readyPath, get, readyHandler)
+	rt.handle("/api", getPost, limitBody(mirrored(coalesced(limited(pooled(apiHandler))))))
+	rt.handle("/enqueue", []string{http.MethodPost}, limitBody(enqueueHandler))
+	rt.handle("/burn", getPost, burnHandler)
+	rt.handle("/flaky", getPost, flakyHandler)
+	rt.handle("/proxy", get, proxyHandler)
+	rt.handle("/call", get, callHandler)
+	rt.handle("/stream", get, streamHandler)
+	rt.handle("/db", get, dbHandler)
+	rt.handleBypass("/metrics", get, newMetricsHandler())
+	rt.handleBypass("/metrics.json", get, protectMetrics(http.HandlerFunc(metricsJSONHandler)))
+	rt.handle("/config", get, configHandler)
+	rt.handle("/uptime", get, uptimeHandler)
+	rt.handle("/scaling-signals", get, scalingSignalsHandler)
+	rt.handle("/admin/routes", get, adminAuth(rt.routesHandler))
+	rt.handle("/admin/latency", []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete}, adminAuth(rt.adminLatencyHandler))
+	rt.handle("/admin/qps-window", []string{http.MethodGet, http.MethodPost, http.MethodPut}, adminAuth(adminQPSWindowHandler))
+	rt.handle("/admin/spike", []string{http.MethodGet, http.MethodPost, http.MethodPut}, adminAuth(adminSpikeHandler))
+	rt.handle("/admin/drain", get, adminAuth(adminDrainHandler))
+	rt.handle("/admin/limits", get, adminAuth(adminLimitsHandler))
+	rt.handle("/admin/runtime", get, adminAuth(adminRuntimeHandler))
+	rt.handle("/admin/events", get, adminAuth(adminEventsHandler))
+	rt.handle("/admin/endpoints", []string{http.MethodGet, http.MethodPost, http.MethodPut}, adminAuth(rt.adminEndpointsHandler))
+	rt.handle("/admin/panic", getPost, adminOnly(adminPanicHandler))
+
+	return rt, errors.Join(rt.errs...)
+}
+
+// List all registered routes
+func (rt *router) routesHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"routes": rt.routes})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAdminRoutes(t *testing.T) {
+	rt := newTestRouter(t)
+	rec := serve(rt, http.MethodGet, "/admin/routes")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	var body struct{ Routes []route }
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	listed := map[string]route{}
+	for _, r := range body.Routes {
+		listed[r.Path] = r
+	}
+
+	tests := []route{
+		{Path: "/", Methods: []string{http.MethodGet}},
+		{Path: healthPath, Methods: []string{http.MethodGet}},
+		{Path: readyPath, Methods: []string{http.MethodGet}},
+		{Path: "/api", Methods: []string{http.MethodGet, http.MethodPost}},
+		{Path: "/burn", Methods: []string{http.MethodGet, http.MethodPost}},
+		{Path: "/enqueue", Methods: []string{http.MethodPost}},
+		{Path: "/metrics", Methods: []string{http.MethodGet}, BypassMetrics: true},
+		{Path: "/admin/routes", Methods: []string{http.MethodGet}},
+	}
+	for _, want := range tests {
+		got, ok := listed[want.Path]
+		if !ok {
+			t.Errorf("%s not listed", want.Path)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s listed as %+v, want %+v", want.Path, got, want)
+		}
+	}
+}
+
+// A path registered twice is reported rather than panicking in the mux
+func TestRouterDuplicateRoute(t *testing.T) {
+	tests := []struct {
+		name   string
+		health string
+		ready  string
+		dup    string
+	}{
+		{"health on a route", "/api", "/ready", `"/api"`},
+		{"ready on a route", "/health", "/burn", `"/burn"`},
+		{"health and ready alike", "/probe", "/probe", `"/probe"`},
+	}
+	for _, tt := range tests {
+		setVar(t, &healthPath, tt.health)
+		setVar(t, &readyPath, tt.ready)
+		_, err := newRouter()
+		if err == nil || !strings.Contains(err.Error(), tt.dup) {
+			t.Errorf("%s: error %v, want one naming %s", tt.name, err, tt.dup)
+		}
+	}
+}
+
+func TestAllowMethods(t *testing.T) {
+	h := allowMethods([]string{http.MethodGet, http.MethodPost}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		method string
+		status int
+	}{
+		{http.MethodGet, http.StatusOK},
+		{http.MethodHead, http.StatusOK}, // allowed wherever GET is
+		{http.MethodPost, http.StatusOK},
+		{http.MethodPut, http.StatusMethodNotAllowed},
+		{http.MethodDelete, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		rec := serve(h, tt.method, "/api")
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.method, rec.Code, tt.status)
+		}
+		if rec.Code == http.StatusMethodNotAllowed && rec.Header().Get("Allow") != "GET, POST" {
+			t.Errorf("%s: Allow %q, want \"GET, POST\"", tt.method, rec.Header().Get("Allow"))
+		}
+	}
+}
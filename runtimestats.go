@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// Report memory, GC and scheduler stats for a quick look without pprof.
+// MemStats is trimmed to the fields that matter for sizing; the per-size
+// class table and the raw pause ring are left out.
+func adminRuntimeHandler(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	// Last five pauses, newest first, and the min/25%/50%/75%/max quantiles
+	gc := debug.GCStats{Pause: make([]time.Duration, 0, 5), PauseQuantiles: make([]time.Duration, 5)}
+	debug.ReadGCStats(&gc)
+	if len(gc.Pause) > 5 {
+		gc.Pause = gc.Pause[:5]
+	}
+	durations := func(ds []time.Duration) []string {
+		out := make([]string, len(ds))
+		for i, d := range ds {
+			out[i] = d.String()
+		}
+		return out
+	}
+	lastGC := ""
+	if gc.NumGC > 0 {
+		lastGC = gc.LastGC.UTC().Format(time.RFC3339Nano)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"memory": map[string]any{
+			"alloc_bytes":         mem.Alloc,
+			"total_alloc_bytes":   mem.TotalAlloc,
+			"sys_bytes":           mem.Sys,
+			"heap_alloc_bytes":    mem.HeapAlloc,
+			"heap_sys_bytes":      mem.HeapSys,
+			"heap_idle_bytes":     mem.HeapIdle,
+			"heap_inuse_bytes":    mem.HeapInuse,
+			"heap_released_bytes": mem.HeapReleased,
+			"heap_objects":        mem.HeapObjects,
+			"stack_inuse_bytes":   mem.StackInuse,
+			"mallocs":             mem.Mallocs,
+			"frees":               mem.Frees,
+		},
+		"gc": map[string]any{
+			"num_gc":          gc.NumGC,
+			"num_forced_gc":   mem.NumForcedGC,
+			"last_gc":         lastGC,
+			"next_gc_bytes":   mem.NextGC,
+			"pause_total":     gc.PauseTotal.String(),
+			"recent_pauses":   durations(gc.Pause),
+			"pause_quantiles": durations(gc.PauseQuantiles),
+			"cpu_fraction":    mem.GCCPUFraction,
+			// A negative limit reads the soft memory limit without changing it
+			"memory_limit_bytes": debug.SetMemoryLimit(-1),
+		},
+		"scheduler": map[string]any{
+			"goroutines": runtime.NumGoroutine(),
+			"num_cpu":    runtime.NumCPU(),
+			"gomaxprocs": runtime.GOMAXPROCS(0),
+			"cgo_calls":  runtime.NumCgoCall(),
+		},
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// /admin/runtime reports each memory, GC and scheduler field with a value
+// of the right shape
+func TestAdminRuntime(t *testing.T) {
+	setVar(t, &adminToken, "")
+	runtime.GC() // so there is a last GC and a pause to report
+	rec := serve(newTestRouter(t), http.MethodGet, "/admin/runtime")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+	var body map[string]map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body is not JSON: %v\n%s", err, rec.Body)
+	}
+
+	positive := func(v any) bool { n, ok := v.(float64); return ok && n > 0 }
+	nonNegative := func(v any) bool { n, ok := v.(float64); return ok && n >= 0 }
+	duration := func(v any) bool {
+		s, ok := v.(string)
+		_, err := time.ParseDuration(s)
+		return ok && err == nil
+	}
+	durations := func(n int) func(v any) bool {
+		return func(v any) bool {
+			list, ok := v.([]any)
+			if !ok || len(list) < 1 || len(list) > n {
+				return false
+			}
+			for _, d := range list {
+				if !duration(d) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	timestamp := func(v any) bool {
+		s, ok := v.(string)
+		_, err := time.Parse(time.RFC3339Nano, s)
+		return ok && err == nil
+	}
+
+	tests := []struct {
+		section, field string
+		valid          func(any) bool
+	}{
+		{"memory", "alloc_bytes", positive},
+		{"memory", "total_alloc_bytes", positive},
+		{"memory", "sys_bytes", positive},
+		{"memory", "heap_alloc_bytes", positive},
+		{"memory", "heap_sys_bytes", positive},
+		{"memory", "heap_idle_bytes", nonNegative},
+		{"memory", "heap_inuse_bytes", positive},
+		{"memory", "heap_released_bytes", nonNegative},
+		{"memory", "heap_objects", positive},
+		{"memory", "stack_inuse_bytes", positive},
+		{"memory", "mallocs", positive},
+		{"memory", "frees", nonNegative},
+		{"gc", "num_gc", positive},
+		{"gc", "num_forced_gc", positive},
+		{"gc", "last_gc", timestamp},
+		{"gc", "next_gc_bytes", positive},
+		{"gc", "pause_total", duration},
+		{"gc", "recent_pauses", durations(5)},
+		{"gc", "pause_quantiles", durations(5)},
+		{"gc", "cpu_fraction", nonNegative},
+		{"gc", "memory_limit_bytes", positive},
+		{"scheduler", "goroutines", positive},
+		{"scheduler", "num_cpu", func(v any) bool { return v == float64(runtime.NumCPU()) }},
+		{"scheduler", "gomaxprocs", func(v any) bool { return v == float64(runtime.GOMAXPROCS(0)) }},
+		{"scheduler", "cgo_calls", nonNegative},
+	}
+	for _, tt := range tests {
+		v, ok := body[tt.section][tt.field]
+		if !ok {
+			t.Errorf("%s.%s missing", tt.section, tt.field)
+		} else if !tt.valid(v) {
+			t.Errorf("%s.%s = %v", tt.section, tt.field, v)
+		}
+	}
+}
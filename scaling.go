@@ -0,0 +1,197 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// HPA's default tolerance: ratios within 10% of 1 keep the current replicas
+const hpaTolerance = 0.1
+
+var (
+	// Gauge for the replica count the HPA formula gives for this pod's QPS
+	recommendedReplicas = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "recommended_replicas",
+			Help: "Replicas the HPA formula recommends from this pod's QPS and SCALING_TARGET_QPS; 0 when no target is set",
+		},
+	)
+
+	// Per-replica QPS target, from SCALING_TARGET_QPS; 0 disables the recommendation
+	scalingTargetQPS float64
+
+	// Replicas currently running, from CURRENT_REPLICAS, since the pod cannot
+	// see the Deployment
+	currentReplicas = 1
+
+	// 95th percentile request duration over the QPS window, published by
+	// calculateQPS; math.Float64bits
+	latencyP95 atomic.Uint64
+)
+
+// HPA's formula, ceil(current * metric / target), taking this pod's value as
+// the per-pod average and skipping changes within the tolerance
+func recommendReplicas(current int, metric, target float64) int {
+	ratio := metric / target
+	if math.Abs(ratio-1) <= hpaTolerance {
+		return current
+	}
+	return max(1, int(math.Ceil(float64(current)*ratio)))
+}
+
+// Update recommended_replicas from the latest QPS
+func updateRecommendation(qps float64) {
+	if scalingTargetQPS > 0 {
+		recommendedReplicas.Set(float64(recommendReplicas(currentReplicas, qps, scalingTargetQPS)))
+	}
+}
+
+// Summarize the signals an autoscaler might act on, read back from the
+// registry so the values match what /metrics reports. The latency p95 is the
+// exception: it covers the QPS window rather than all time, so it follows the
+// current load.
+func scalingSignalsHandler(w http.ResponseWriter, r *http.Request) {
+	families, err := metricsRegistry.Gather()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "gathering metrics failed: "+err.Error())
+		return
+	}
+	byName := make(map[string]*dto.MetricFamily, len(families))
+	for _, mf := range families {
+		byName[mf.GetName()] = mf
+	}
+
+	writeJSON(w, http.StatusOK, map[string]float64{
+		"qps":                  sumValues(byName["http_requests_per_second"]),
+		"qps_smoothed":         sumValues(byName["http_requests_per_second_smoothed"]),
+		"cost_per_second":      sumValues(byName["request_cost_per_second"]),
+		"in_flight":            sumValues(byName["http_requests_in_flight"]),
+		"queue_depth":          sumValues(byName["worker_pool_queue_depth"]),
+		"error_ratio":          sumValues(byName["http_error_ratio"]),
+		"latency_p95_seconds":  math.Float64frombits(latencyP95.Load()),
+		"recommended_replicas": sumValues(byName["recommended_replicas"]),
+	})
+}
+
+// Sum of the gauge or counter values across all series of a family; 0 if absent
+func sumValues(mf *dto.MetricFamily) float64 {
+	total := 0.0
+	for _, m := range mf.GetMetric() {
+		switch {
+		case m.Gauge != nil:
+			total += m.Gauge.GetValue()
+		case m.Counter != nil:
+			total += m.Counter.GetValue()
+		}
+	}
+	return total
+}
+
+// Cumulative bucket counts merged across all series of a histogram
+type histogramBuckets struct {
+	counts map[float64]uint64 // by upper bound
+	total  uint64
+}
+
+// Merge the buckets of every histogram series c collects
+func collectBuckets(c prometheus.Collector) histogramBuckets {
+	return collectPathBuckets(c, "")
+}
+
+// Merge the buckets of the histogram series c collects for path, or of every
+// series when path is empty
+func collectPathBuckets(c prometheus.Collector, path string) histogramBuckets {
+	b := histogramBuckets{counts: map[float64]uint64{}}
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	for m := range ch {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil || pb.Histogram == nil {
+			continue
+		}
+		if path != "" && !hasLabel(&pb, "path", path) {
+			continue
+		}
+		for _, bucket := range pb.GetHistogram().GetBucket() {
+			b.counts[bucket.GetUpperBound()] += bucket.GetCumulativeCount()
+		}
+		b.total += pb.GetHistogram().GetSampleCount()
+	}
+	return b
+}
+
+func hasLabel(m *dto.Metric, name, value string) bool {
+	for _, l := range m.GetLabel() {
+		if l.GetName() == name {
+			return l.GetValue() == value
+		}
+	}
+	return false
+}
+
+// Observations since an earlier collection; series are never deleted, so
+// every count only grows
+func (b histogramBuckets) since(earlier histogramBuckets) histogramBuckets {
+	d := histogramBuckets{counts: make(map[float64]uint64, len(b.counts)), total: b.total - earlier.total}
+	for ub, count := range b.counts {
+		d.counts[ub] = count - earlier.counts[ub]
+	}
+	return d
+}
+
+// Quantile of the observations, linearly interpolated within the bucket as
+// PromQL's histogram_quantile does; 0 if there are none
+func (b histogramBuckets) quantile(q float64) float64 {
+	if b.total == 0 {
+		return 0
+	}
+
+	bounds := make([]float64, 0, len(b.counts))
+	for ub := range b.counts {
+		bounds = append(bounds, ub)
+	}
+	sort.Float64s(bounds)
+
+	rank := q * float64(b.total)
+	lower, below := 0.0, uint64(0)
+	for _, ub := range bounds {
+		count := b.counts[ub]
+		if float64(count) >= rank {
+			if count == below {
+				return ub
+			}
+			return lower + (ub-lower)*(rank-float64(below))/float64(count-below)
+		}
+		lower, below = ub, count
+	}
+	// Rank falls in the implicit +Inf bucket: report the highest finite bound
+	return lower
+}
+
+// Number of observations at or below v, linearly interpolated within the
+// bucket like quantile; observations past the highest bound count as above
+func (b histogramBuckets) countBelow(v float64) float64 {
+	bounds := make([]float64, 0, len(b.counts))
+	for ub := range b.counts {
+		bounds = append(bounds, ub)
+	}
+	sort.Float64s(bounds)
+
+	lower, below := 0.0, uint64(0)
+	for _, ub := range bounds {
+		count := b.counts[ub]
+		if v <= ub {
+			return float64(below) + float64(count-below)*(v-lower)/(ub-lower)
+		}
+		lower, below = ub, count
+	}
+	return float64(below)
+}
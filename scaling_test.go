@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Windowed p95 after the latest tick
+func currentP95() float64 {
+	return math.Float64frombits(latencyP95.Load())
+}
+
+// One second of traffic and the p95 expected after it
+type p95Tick struct {
+	fast     int // 4ms requests
+	slow     int // 2s requests
+	min, max float64
+}
+
+// The p95 follows the requests in the QPS window, not everything since startup
+func TestLatencyP95OverWindow(t *testing.T) {
+	fast := [2]float64{0.0025, 0.005}
+	slow := [2]float64{1, 2.5}
+	tests := []struct {
+		name   string
+		window int64
+		ticks  []p95Tick
+	}{
+		// All-time the slow tail is under 5% and would not show
+		{"one second", 1, []p95Tick{
+			{1000, 0, fast[0], fast[1]},
+			{0, 20, slow[0], slow[1]},
+			{0, 0, 0, 0},
+		}},
+		{"two seconds", 2, []p95Tick{
+			{1000, 0, fast[0], fast[1]},
+			{0, 20, fast[0], fast[1]},
+			{0, 0, slow[0], slow[1]},
+			{0, 0, 0, 0},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setAtomic(t, &qpsWindow, tt.window)
+			durations := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "test_duration_seconds", Buckets: prometheus.DefBuckets}, []string{"path"})
+			c := newQPSCalculator(durations)
+
+			for i, tick := range tt.ticks {
+				for range tick.fast {
+					durations.WithLabelValues("/api").Observe(0.004)
+				}
+				for range tick.slow {
+					durations.WithLabelValues("/api").Observe(2)
+				}
+				c.tick()
+				if p95 := currentP95(); p95 < tick.min || p95 > tick.max {
+					t.Errorf("tick %d: p95 = %g, want between %g and %g", i+1, p95, tick.min, tick.max)
+				}
+			}
+		})
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	// 10 observations up to 0.1s, 10 more up to 1s
+	b := histogramBuckets{counts: map[float64]uint64{0.1: 10, 1: 20}, total: 20}
+	tests := []struct {
+		q, want float64
+	}{
+		{0.25, 0.05},
+		{0.5, 0.1},
+		{0.75, 0.55},
+		{1, 1},
+	}
+	for _, tt := range tests {
+		if got := b.quantile(tt.q); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("quantile(%g) = %g, want %g", tt.q, got, tt.want)
+		}
+	}
+
+	inf := histogramBuckets{counts: map[float64]uint64{0.1: 1}, total: 10}
+	if got := inf.quantile(0.95); got != 0.1 {
+		t.Errorf("quantile in the +Inf bucket = %g, want the highest bound 0.1", got)
+	}
+	if got := (histogramBuckets{}).quantile(0.95); got != 0 {
+		t.Errorf("quantile without observations = %g, want 0", got)
+	}
+}
+
+func TestScalingSignalsFields(t *testing.T) {
+	rec := serve(http.HandlerFunc(scalingSignalsHandler), http.MethodGet, "/scaling-signals")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var signals map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &signals); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	for _, field := range []string{"qps", "qps_smoothed", "cost_per_second", "in_flight", "queue_depth", "error_ratio", "latency_p95_seconds", "recommended_replicas"} {
+		if _, ok := signals[field].(float64); !ok {
+			t.Errorf("field %s = %v, want a number", field, signals[field])
+		}
+	}
+}
+
+func TestRecommendReplicas(t *testing.T) {
+	tests := []struct {
+		current        int
+		metric, target float64
+		want           int
+	}{
+		{1, 100, 100, 1},
+		{1, 250, 100, 3},
+		{3, 250, 100, 8}, // ceil(7.5)
+		{4, 105, 100, 4}, // within the tolerance
+		{4, 92, 100, 4},  // within the tolerance
+		{4, 115, 100, 5}, // ceil(4.6)
+		{10, 20, 100, 2}, // scale down
+		{5, 0, 100, 1},   // idle never goes below one replica
+		{2, 1000, 0.5, 4000},
+	}
+	for _, tt := range tests {
+		if got := recommendReplicas(tt.current, tt.metric, tt.target); got != tt.want {
+			t.Errorf("recommendReplicas(%d, %g, %g) = %d, want %d", tt.current, tt.metric, tt.target, got, tt.want)
+		}
+	}
+}
+
+// The recommendation reaches /scaling-signals, and stays unset without a target
+func TestRecommendedReplicasSignal(t *testing.T) {
+	useTestRegistry(t)
+	metricsRegisterer.MustRegister(recommendedReplicas)
+	tests := []struct {
+		target   float64
+		replicas int
+		qps      float64
+		want     float64
+	}{
+		{50, 2, 200, 8},
+		{50, 2, 100, 4},
+		{50, 2, 52, 2}, // within the tolerance
+		{0, 2, 200, 0},
+	}
+	for _, tt := range tests {
+		setVar(t, &scalingTargetQPS, tt.target)
+		setVar(t, &currentReplicas, tt.replicas)
+		recommendedReplicas.Set(0)
+		updateRecommendation(tt.qps)
+
+		rec := serve(http.HandlerFunc(scalingSignalsHandler), http.MethodGet, "/scaling-signals")
+		var signals map[string]float64
+		if err := json.Unmarshal(rec.Body.Bytes(), &signals); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if got := signals["recommended_replicas"]; got != tt.want {
+			t.Errorf("target %g with %d replicas at %g qps: recommended_replicas %g, want %g", tt.target, tt.replicas, tt.qps, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// One step of a latency schedule: from offset after startup, /api uses latency
+type latencyStep struct {
+	offset  time.Duration
+	latency time.Duration
+}
+
+// Latency profile over the experiment timeline, set with
+// -latency-schedule "0s=10ms,60s=100ms,120s=10ms". Implements flag.Value.
+type latencySchedule []latencyStep
+
+var (
+	// Schedule applied by runLatencySchedule, empty when not configured
+	apiLatencySchedule latencySchedule
+
+	// Time the schedule timeline started
+	scheduleStart time.Time
+
+	// Time source of the schedule, replaced in tests
+	scheduleClock clock = systemClock{}
+)
+
+// Time source for timelines that tests need to step through
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (s *latencySchedule) String() string {
+	parts := make([]string, len(*s))
+	for i, step := range *s {
+		parts[i] = step.offset.String() + "=" + step.latency.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func (s *latencySchedule) Set(value string) error {
+	var steps latencySchedule
+	for _, pair := range strings.Split(value, ",") {
+		offsetStr, latencyStr, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return fmt.Errorf("step %q: expected offset=duration", pair)
+		}
+		offset, err := time.ParseDuration(offsetStr)
+		if err != nil || offset < 0 {
+			return fmt.Errorf("step %q: invalid offset", pair)
+		}
+		latency, err := parseLatency(latencyStr)
+		if err != nil {
+			return fmt.Errorf("step %q: %w", pair, err)
+		}
+		steps = append(steps, latencyStep{offset: offset, latency: latency})
+	}
+	slices.SortStableFunc(steps, func(a, b latencyStep) int {
+		return cmp.Compare(a.offset, b.offset)
+	})
+	*s = steps
+	return nil
+}
+
+// Latency in effect at elapsed time into the schedule; false before the first step
+func (s latencySchedule) at(elapsed time.Duration) (time.Duration, bool) {
+	latency, ok := time.Duration(0), false
+	for _, step := range s {
+		if step.offset > elapsed {
+			break
+		}
+		latency, ok = step.latency, true
+	}
+	return latency, ok
+}
+
+// Apply each step to the /api latency as its offset passes
+func runLatencySchedule(ctx context.Context, schedule latencySchedule, start time.Time) {
+	for _, step := range schedule {
+		select {
+		case <-ctx.Done():
+			return
+		case <-scheduleClock.After(start.Add(step.offset).Sub(scheduleClock.Now())):
+		}
+		apiLatency.Store(int64(step.latency))
+		log.Printf("Latency schedule: /api latency set to %s at +%s", step.latency, step.offset)
+	}
+}
+
+// Effective runtime configuration
+func configHandler(w http.ResponseWriter, r *http.Request) {
+	cfg := map[string]any{
+		"api_latency":  time.Duration(apiLatency.Load()).String(),
+		"latency_dist": latencyDist.kind,
+		"qps_window":   qpsWindow.Load(),
+	}
+	if len(apiLatencySchedule) > 0 {
+		elapsed := scheduleClock.Now().Sub(scheduleStart)
+		scheduled := map[string]any{
+			"schedule": apiLatencySchedule.String(),
+			"elapsed":  elapsed.Truncate(time.Millisecond).String(),
+		}
+		if latency, ok := apiLatencySchedule.at(elapsed); ok {
+			scheduled["current"] = latency.String()
+		}
+		cfg["latency_schedule"] = scheduled
+	}
+	if latencyPerQPS > 0 {
+		cfg["latency_contention"] = map[string]any{
+			"per_qps":   latencyPerQPS.String(),
+			"max":       contentionMaxLatency.String(),
+			"effective": effectiveAPILatency("/api").String(),
+		}
+	}
+	writeJSON(w, http.StatusOK, cfg)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Clock that only moves when advanced
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1_700_000_000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Move the clock forward, firing every waiter that came due
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = pending
+}
+
+// Wait for the schedule goroutine to apply want
+func waitForLatency(t *testing.T, want time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Duration(apiLatency.Load()) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("latency %s, want %s", time.Duration(apiLatency.Load()), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLatencyScheduleFollowsClock(t *testing.T) {
+	clk := newFakeClock()
+	setVar[clock](t, &scheduleClock, clk)
+	setAtomic(t, &apiLatency, int64(5*time.Millisecond))
+	var schedule latencySchedule
+	if err := schedule.Set("30s=10ms,60s=100ms,120s=10ms"); err != nil {
+		t.Fatal(err)
+	}
+	setVar(t, &apiLatencySchedule, schedule)
+	setVar(t, &scheduleStart, clk.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		runLatencySchedule(ctx, schedule, scheduleStart)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	tests := []struct {
+		advance time.Duration
+		want    time.Duration
+		current string // reported by /config; empty before the first step
+	}{
+		{0, 5 * time.Millisecond, ""},
+		{29 * time.Second, 5 * time.Millisecond, ""},
+		{time.Second, 10 * time.Millisecond, "10ms"},
+		{45 * time.Second, 100 * time.Millisecond, "100ms"},
+		// The last step resets the latency and it stays there
+		{45 * time.Second, 10 * time.Millisecond, "10ms"},
+		{time.Hour, 10 * time.Millisecond, "10ms"},
+	}
+	for _, tt := range tests {
+		clk.advance(tt.advance)
+		waitForLatency(t, tt.want)
+		elapsed := clk.Now().Sub(scheduleStart)
+
+		var cfg struct {
+			Schedule map[string]string `json:"latency_schedule"`
+		}
+		rec := serve(http.HandlerFunc(configHandler), http.MethodGet, "/config")
+		if err := json.Unmarshal(rec.Body.Bytes(), &cfg); err != nil {
+			t.Fatalf("decode /config: %v", err)
+		}
+		if got := cfg.Schedule["current"]; got != tt.current {
+			t.Errorf("at +%s: /config current %q, want %q", elapsed, got, tt.current)
+		}
+	}
+}
+
+func TestLatencyScheduleParse(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"0s=10ms", "0s=10ms", false},
+		{"60s=100ms, 0s=10ms", "0s=10ms,1m0s=100ms", false},
+		{"10ms", "", true},
+		{"-1s=10ms", "", true},
+		{"0s=1h", "", true},
+	}
+	for _, tt := range tests {
+		var s latencySchedule
+		err := s.Set(tt.value)
+		if (err != nil) != tt.wantErr || (err == nil && s.String() != tt.want) {
+			t.Errorf("Set(%q) = %q, %v", tt.value, s.String(), err)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Counter for requests issued by the self-load client
+	selfLoadRequestsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "self_load_requests_total",
+			Help: "Total number of requests issued by the self-load client",
+		},
+	)
+
+	// Counter for self-load requests that failed or returned a non-2xx status
+	selfLoadErrorsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "self_load_errors_total",
+			Help: "Total number of failed self-load requests",
+		},
+	)
+
+	// Counter for connections used by the self-load client, by reuse
+	selfLoadConnectionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "self_load_connections_total",
+			Help: "Connections obtained by the self-load client, by whether they were reused",
+		},
+		[]string{"reused"},
+	)
+)
+
+// Highest SELF_LOAD_QPS; faster rates round the tick interval down to zero,
+// which time.NewTicker rejects
+const maxSelfLoadQPS = 1e9
+
+// Settings for the self-generated load
+type selfLoadConfig struct {
+	// Requests per second to send to ourselves; 0 disables self-load
+	qps float64
+	// Path requested on every call
+	path string
+	// Number of concurrent client workers and idle keep-alive connections
+	concurrency int
+}
+
+// Base URL of our own server for the first listener
+func selfURL(ln net.Listener, scheme string) string {
+	addr := ln.Addr().(*net.TCPAddr)
+	ip := addr.IP
+	if ip.IsUnspecified() {
+		if ip.To4() != nil {
+			ip = net.IPv4(127, 0, 0, 1)
+		} else {
+			ip = net.IPv6loopback
+		}
+	}
+	return scheme + "://" + net.JoinHostPort(ip.String(), strconv.Itoa(addr.Port))
+}
+
+// Generate load against ourselves at the configured rate until ctx is done
+func runSelfLoad(ctx context.Context, cfg selfLoadConfig, baseURL string) {
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			MaxIdleConns:        cfg.concurrency,
+			MaxIdleConnsPerHost: cfg.concurrency,
+			IdleConnTimeout:     90 * time.Second,
+			// We are calling ourselves, so our own certificate need not be trusted
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	// Ticks are handed to workers; if all are busy the tick is dropped
+	ticks := make(chan struct{})
+	for i := 0; i < cfg.concurrency; i++ {
+		startBackground(func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticks:
+					selfLoadRequest(ctx, client, baseURL+cfg.path)
+				}
+			}
+		})
+	}
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.qps))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			select {
+			case ticks <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// Issue one self-load request, tracing whether the connection was reused
+func selfLoadRequest(ctx context.Context, client *http.Client, url string) {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			selfLoadConnectionsTotal.WithLabelValues(strconv.FormatBool(info.Reused)).Inc()
+		},
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, url, nil)
+	if err != nil {
+		selfLoadErrorsTotal.Inc()
+		return
+	}
+	req.Header.Set("User-Agent", "scaling-poc-self-load")
+
+	selfLoadRequestsTotal.Inc()
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			selfLoadErrorsTotal.Inc()
+		}
+		return
+	}
+	// Drain the body so the connection goes back to the pool
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		selfLoadErrorsTotal.Inc()
+	}
+}
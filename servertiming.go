@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Emit Server-Timing from metricsMiddleware, from SERVER_TIMING
+var serverTimingEnabled bool
+
+// Server-Timing metric value for d, in milliseconds as the spec requires
+func serverTiming(name string, d time.Duration) string {
+	return fmt.Sprintf("%s;dur=%.3f", name, float64(d)/float64(time.Millisecond))
+}
+
+// Add Server-Timing as the headers are written. The handler is not done
+// yet, so the header carries the time to the first byte and the total is
+// sent as a trailer by finishServerTiming.
+func (rw *responseWriter) addServerTiming() {
+	if !serverTimingEnabled || rw.start.IsZero() {
+		return
+	}
+	rw.Header().Set("Server-Timing", serverTiming("app", time.Since(rw.start)))
+}
+
+// Record the full handler duration once it returns: as the header when the
+// handler wrote nothing, since net/http writes the headers after us, or
+// otherwise as a trailer. Trailers only reach the client on chunked and
+// HTTP/2 responses; the header is always there.
+func (rw *responseWriter) finishServerTiming() {
+	if !serverTimingEnabled || rw.start.IsZero() {
+		return
+	}
+	total := serverTiming("total", time.Since(rw.start))
+	if !rw.wroteHeader {
+		rw.Header().Set("Server-Timing", total)
+		return
+	}
+	rw.Header().Set(http.TrailerPrefix+"Server-Timing", total)
+}
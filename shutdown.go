@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// Background loops started with startBackground, stopped during shutdown
+var background sync.WaitGroup
+
+// Run fn in a goroutine tracked by the background wait group
+func startBackground(fn func()) {
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		fn()
+	}()
+}
+
+// One step of the ordered shutdown sequence
+type shutdownPhase struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// Run the phases in order within the deadline of ctx. A failed phase is logged
+// and the sequence continues so later phases such as the metrics flush still
+// get their chance; phases not started before the deadline are skipped.
+func runShutdown(ctx context.Context, phases []shutdownPhase) error {
+	var errs []error
+	for _, phase := range phases {
+		if err := ctx.Err(); err != nil {
+			logEvent(eventShutdownPhase, "Shutdown phase skipped", "phase", phase.name, "status", "skipped", "error", err.Error())
+			errs = append(errs, fmt.Errorf("%s: %w", phase.name, err))
+			continue
+		}
+
+		start := time.Now()
+		logEvent(eventShutdownPhase, "Shutdown phase started", "phase", phase.name, "status", "started")
+		if err := phase.run(ctx); err != nil {
+			logEvent(eventShutdownPhase, "Shutdown phase failed", "phase", phase.name, "status", "failed",
+				"duration", time.Since(start).String(), "error", err.Error())
+			errs = append(errs, fmt.Errorf("%s: %w", phase.name, err))
+			continue
+		}
+		logEvent(eventShutdownPhase, "Shutdown phase completed", "phase", phase.name, "status", "completed",
+			"duration", time.Since(start).String())
+	}
+	return errors.Join(errs...)
+}
+
+// Wait for all background loops to return, or for ctx to expire
+func waitBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Push the final metric values to a Pushgateway when PUSHGATEWAY_URL is set
+func flushMetrics(ctx context.Context) error {
+	url := os.Getenv("PUSHGATEWAY_URL")
+	if url == "" {
+		return nil
+	}
+
+	job := envString("PUSHGATEWAY_JOB", "scaling-poc")
+	pusher := push.New(url, job).Gatherer(metricsRegistry)
+	if hostname, err := os.Hostname(); err == nil {
+		pusher = pusher.Grouping("instance", hostname)
+	}
+	return pusher.PushContext(ctx)
+}
+
+// Grace delay for a shutdown triggered by sig: SIGTERM comes from Kubernetes
+// and waits for load balancers, while Ctrl-C in development has none to wait for
+func graceDelayFor(sig os.Signal) time.Duration {
+	if sig == syscall.SIGINT {
+		return 0
+	}
+	return shutdownGraceDelay
+}
+
+// Keep serving while the pod is unready so load balancers and kube-proxy
+// stop routing to it before connections start being refused
+func waitGraceDelay(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Reject new app requests with 503 once draining starts, closing the window
+// between the signal and server.Shutdown in which they would still be
+// handled. Requests already in the handler are unaffected. Probes, admin and
+// /metrics are not gated so the drain stays observable.
+func rejectWhenDraining(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if draining.Load() {
+			writeUnavailable(w, "draining", "server is shutting down")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Ask clients to close their connection once draining starts, so keep-alive
+// clients reconnect, likely to another pod, instead of reusing this one.
+// net/http closes the connection after writing a response with this header.
+func closeWhenDraining(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if draining.Load() {
+			w.Header().Set("Connection", "close")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Report drain progress so a controller can wait for in-flight requests to
+// finish; the count excludes this request
+func adminDrainHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"draining":  draining.Load(),
+		"in_flight": max(inFlight.Load()-1, 0),
+	})
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Phases run in order; a failure does not stop the sequence, while phases
+// reached after the deadline are skipped
+func TestRunShutdownOrder(t *testing.T) {
+	errPhase := errors.New("phase failed")
+	tests := []struct {
+		name    string
+		fail    string // phase returning an error
+		timeout string // phase that runs into the deadline
+		ran     []string
+		errs    []string // phases named in the returned error
+	}{
+		{name: "all phases", ran: []string{"readiness", "drain", "background", "flush"}},
+		{name: "failed phase", fail: "drain", ran: []string{"readiness", "drain", "background", "flush"}, errs: []string{"drain"}},
+		{name: "deadline", timeout: "drain", ran: []string{"readiness", "drain"}, errs: []string{"drain", "background", "flush"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			var ran []string
+			var phases []shutdownPhase
+			for _, name := range []string{"readiness", "drain", "background", "flush"} {
+				phases = append(phases, shutdownPhase{name, func(ctx context.Context) error {
+					ran = append(ran, name)
+					switch name {
+					case tt.fail:
+						return errPhase
+					case tt.timeout:
+						cancel()
+						return ctx.Err()
+					}
+					return nil
+				}})
+			}
+
+			err := runShutdown(ctx, phases)
+			if !reflect.DeepEqual(ran, tt.ran) {
+				t.Errorf("ran %q, want %q", ran, tt.ran)
+			}
+			if tt.errs == nil {
+				if err != nil {
+					t.Errorf("error %v, want none", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("no error, want one naming %q", tt.errs)
+			}
+			if got := strings.Count(err.Error(), "\n") + 1; got != len(tt.errs) {
+				t.Errorf("error %q reports %d phases, want %d", err, got, len(tt.errs))
+			}
+			for _, name := range tt.errs {
+				if !strings.Contains(err.Error(), name+": ") {
+					t.Errorf("error %q does not name phase %s", err, name)
+				}
+			}
+			if tt.fail != "" && !errors.Is(err, errPhase) {
+				t.Errorf("error %v does not wrap the phase error", err)
+			}
+		})
+	}
+}
+
+// Both readiness and app routes answer a drain with a JSON 503 naming the
+// reason and a Retry-After
+func TestDrainResponseBody(t *testing.T) {
+	setBool(t, &ready, false)
+	setBool(t, &shuttingDown, true)
+	setBool(t, &draining, true)
+	setVar(t, &readyMinRequests, 0)
+	setVar(t, &shedResponseBody, "")
+	rt := newTestRouter(t)
+
+	for _, target := range []string{readyPath, "/api"} {
+		rec := serve(rt, http.MethodGet, target)
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s: status %d, want 503", target, rec.Code)
+			continue
+		}
+		if got := rec.Header().Get("Retry-After"); got != strconv.Itoa(retryAfterSeconds) {
+			t.Errorf("%s: Retry-After %q, want %d", target, got, retryAfterSeconds)
+		}
+		if got := rec.Header().Get("Content-Type"); got != "application/json" {
+			t.Errorf("%s: Content-Type %q, want application/json", target, got)
+		}
+		var body errorEnvelope
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: decode body: %v", target, err)
+		}
+		if body.Error.Code != http.StatusServiceUnavailable || body.Error.Reason != "draining" || body.Error.Message == "" {
+			t.Errorf("%s: body %+v, want a 503 draining error", target, body.Error)
+		}
+	}
+}
+
+// Once draining starts, responses ask keep-alive clients to reconnect, and
+// the server closes the connection after them
+func TestCloseWhenDraining(t *testing.T) {
+	setBool(t, &draining, false)
+	rt := newTestRouter(t)
+	srv := httptest.NewServer(rt)
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		draining bool
+		path     string
+		close    bool
+	}{
+		{false, "/health", false},
+		{true, "/health", true},
+		{true, "/metrics", true},
+		// Rejected app requests close their connection too
+		{true, "/api", true},
+	}
+	for _, tt := range tests {
+		draining.Store(tt.draining)
+		resp, err := srv.Client().Get(srv.URL + tt.path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", tt.path, err)
+		}
+		resp.Body.Close()
+		// The client consumes the Connection: close header into resp.Close
+		if resp.Close != tt.close {
+			t.Errorf("draining %v, %s: connection closed = %v, want %v", tt.draining, tt.path, resp.Close, tt.close)
+		}
+	}
+}
+
+// New app requests get a 503 once draining starts; probes, admin and
+// /metrics stay reachable
+func TestRejectWhenDraining(t *testing.T) {
+	setBool(t, &draining, false)
+	setAtomic(t, &apiLatency, 0)
+	rt := newTestRouter(t)
+
+	tests := []struct {
+		draining bool
+		path     string
+		status   int
+	}{
+		{false, "/api", http.StatusOK},
+		{true, "/api", http.StatusServiceUnavailable},
+		{true, "/uptime", http.StatusServiceUnavailable},
+		{true, "/health", http.StatusOK},
+		{true, "/metrics", http.StatusOK},
+		{true, "/admin/drain", http.StatusOK},
+	}
+	for _, tt := range tests {
+		draining.Store(tt.draining)
+		if rec := serve(rt, http.MethodGet, tt.path); rec.Code != tt.status {
+			t.Errorf("draining %v, %s: status %d, want %d", tt.draining, tt.path, rec.Code, tt.status)
+		}
+	}
+}
+
+// A request already past the gate when draining starts still completes
+func TestRejectWhenDrainingLetsInFlightFinish(t *testing.T) {
+	setBool(t, &draining, false)
+	entered, release := make(chan struct{}), make(chan struct{})
+	h := rejectWhenDraining(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	}))
+
+	done := make(chan int)
+	go func() { done <- serve(h, http.MethodGet, "/api").Code }()
+	<-entered
+	draining.Store(true)
+	if rec := serve(h, http.MethodGet, "/api"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("new request during drain: status %d, want 503", rec.Code)
+	}
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("in-flight request: status %d, want 200", code)
+	}
+}
+
+// SIGTERM waits out the grace delay so load balancers catch up; SIGINT skips it
+func TestGraceDelayBySignal(t *testing.T) {
+	setVar(t, &shutdownGraceDelay, 50*time.Millisecond)
+
+	tests := []struct {
+		sig      syscall.Signal
+		minDelay time.Duration
+		maxDelay time.Duration
+	}{
+		{syscall.SIGTERM, 50 * time.Millisecond, time.Second},
+		{syscall.SIGINT, 0, 20 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		if err := waitGraceDelay(context.Background(), graceDelayFor(tt.sig)); err != nil {
+			t.Errorf("%s: %v", tt.sig, err)
+		}
+		if elapsed := time.Since(start); elapsed < tt.minDelay || elapsed > tt.maxDelay {
+			t.Errorf("%s: waited %s, want between %s and %s", tt.sig, elapsed, tt.minDelay, tt.maxDelay)
+		}
+	}
+}
+
+// The grace delay gives way to the shutdown deadline
+func TestWaitGraceDelayDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := waitGraceDelay(ctx, time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error %v, want the deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("waited %s past a 20ms deadline", elapsed)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Gauge for how fast each latency SLO consumes its error budget
+	latencySLOBurnRate = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "latency_slo_burn_rate",
+			Help: "Error budget burn rate of the latency SLO over its window; 1 spends the budget exactly",
+		},
+		[]string{"path"},
+	)
+
+	// Latency SLOs from LATENCY_SLOS
+	latencySLOs []*latencySLO
+)
+
+// Default window for SLOs that do not set one
+const defaultSLOWindow = 5 * time.Minute
+
+// Objective that a fraction of requests to path complete within threshold,
+// e.g. 99% of /api requests within 100ms. Compliance is read from the
+// http_request_duration_seconds buckets, so a threshold between two bucket
+// bounds is interpolated the way PromQL would.
+type latencySLO struct {
+	path      string
+	threshold time.Duration
+	objective float64
+	window    time.Duration
+
+	// Ring of cumulative duration buckets for path, one per second of the window
+	samples []histogramBuckets
+}
+
+// Parse comma-separated SLOs of the form path:threshold:objective[:window],
+// e.g. "/api:100ms:0.99:5m,/burn:2s:0.9"
+func parseLatencySLOs(value string) ([]*latencySLO, error) {
+	var slos []*latencySLO
+	seen := map[string]bool{}
+	for _, spec := range strings.Split(value, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		parts := strings.Split(spec, ":")
+		if len(parts) != 3 && len(parts) != 4 {
+			return nil, fmt.Errorf("SLO %q: want path:threshold:objective[:window]", spec)
+		}
+		slo := &latencySLO{path: parts[0], window: defaultSLOWindow}
+		if !strings.HasPrefix(slo.path, "/") {
+			return nil, fmt.Errorf("SLO %q: path must start with /", spec)
+		}
+		if seen[slo.path] {
+			return nil, fmt.Errorf("SLO %q: duplicate path", spec)
+		}
+		seen[slo.path] = true
+
+		var err error
+		if slo.threshold, err = time.ParseDuration(parts[1]); err != nil || slo.threshold <= 0 {
+			return nil, fmt.Errorf("SLO %q: threshold must be a positive duration", spec)
+		}
+		if slo.objective, err = strconv.ParseFloat(parts[2], 64); err != nil || slo.objective <= 0 || slo.objective >= 1 {
+			return nil, fmt.Errorf("SLO %q: objective must be between 0 and 1 exclusive", spec)
+		}
+		if len(parts) == 4 {
+			if slo.window, err = time.ParseDuration(parts[3]); err != nil || slo.window < time.Second {
+				return nil, fmt.Errorf("SLO %q: window must be at least 1s", spec)
+			}
+		}
+		slos = append(slos, slo)
+	}
+	return slos, nil
+}
+
+// Burn rate calculator runs in background, sampling the histogram every second.
+// The burn rate is the fraction of slow requests in the window divided by the
+// budget (1 - objective): 1 means the budget runs out exactly at the end of
+// the SLO period, 10 means ten times faster.
+func trackLatencySLO(ctx context.Context, slo *latencySLO) {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	latencySLOBurnRate.WithLabelValues(slo.path).Set(0)
+	hb := newHeartbeat("latency_slo "+slo.path, time.Second)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			hb.beat()
+			slo.tick(collectPathBuckets(httpRequestDuration, slo.path))
+		}
+	}
+}
+
+// Add a sample of the path's duration buckets and publish the burn rate over
+// the window
+func (slo *latencySLO) tick(sample histogramBuckets) {
+	size := int(slo.window / time.Second)
+	slo.samples = append(slo.samples, sample)
+	if len(slo.samples) > size+1 {
+		slo.samples = slo.samples[1:]
+	}
+
+	oldest, newest := slo.samples[0], slo.samples[len(slo.samples)-1]
+	window := newest.since(oldest)
+
+	burn := 0.0
+	if window.total > 0 {
+		slow := float64(window.total) - window.countBelow(slo.threshold.Seconds())
+		burn = slow / float64(window.total) / (1 - slo.objective)
+	}
+	latencySLOBurnRate.WithLabelValues(slo.path).Set(burn)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestParseLatencySLOs(t *testing.T) {
+	type slo struct {
+		path      string
+		threshold time.Duration
+		objective float64
+		window    time.Duration
+	}
+	tests := []struct {
+		value string
+		slos  []slo // nil for an error
+	}{
+		{"", []slo{}},
+		{"/api:100ms:0.99", []slo{{path: "/api", threshold: 100 * time.Millisecond, objective: 0.99, window: defaultSLOWindow}}},
+		{" /api:100ms:0.99:1m , /burn:2s:0.9 ", []slo{
+			{path: "/api", threshold: 100 * time.Millisecond, objective: 0.99, window: time.Minute},
+			{path: "/burn", threshold: 2 * time.Second, objective: 0.9, window: defaultSLOWindow},
+		}},
+		{"/api:100ms", nil},
+		{"api:100ms:0.99", nil},
+		{"/api:100ms:0.99,/api:1s:0.9", nil},
+		{"/api:0s:0.99", nil},
+		{"/api:100ms:1", nil},
+		{"/api:100ms:0", nil},
+		{"/api:100ms:0.99:500ms", nil},
+	}
+	for _, tt := range tests {
+		slos, err := parseLatencySLOs(tt.value)
+		if tt.slos == nil {
+			if err == nil {
+				t.Errorf("%q: no error", tt.value)
+			}
+			continue
+		}
+		if err != nil || len(slos) != len(tt.slos) {
+			t.Errorf("%q: %d SLOs, error %v, want %d", tt.value, len(slos), err, len(tt.slos))
+			continue
+		}
+		for i, want := range tt.slos {
+			got := slos[i]
+			if got.path != want.path || got.threshold != want.threshold || got.objective != want.objective || got.window != want.window {
+				t.Errorf("%q: SLO %d = %s %s %g %s, want %s %s %g %s", tt.value, i,
+					got.path, got.threshold, got.objective, got.window, want.path, want.threshold, want.objective, want.window)
+			}
+		}
+	}
+}
+
+// The burn rate rises with slow requests, relative to the error budget, and
+// recovers once they leave the window
+func TestLatencySLOBurnRate(t *testing.T) {
+	slos, err := parseLatencySLOs("/slo:100ms:0.9:3s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slo := slos[0]
+	durations := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "test_duration_seconds", Buckets: prometheus.DefBuckets}, []string{"path", "method"})
+
+	tests := []struct {
+		fast, slow int // requests during the second before the tick
+		burn       float64
+	}{
+		{0, 0, 0},                // first sample
+		{10, 0, 0},               // within the SLO
+		{9, 1, 0.5},              // 1 of 20 slow, half the 10% budget
+		{0, 10, 11.0 / 30 / 0.1}, // 11 of 30
+		{10, 0, 11.0 / 30 / 0.1}, // 11 of 30
+		{10, 0, 10.0 / 30 / 0.1}, // the first slow request rolled out
+		{10, 0, 0},               // recovered
+	}
+	for i, tt := range tests {
+		// 100ms is a bucket bound, so requests right on the threshold count as fast
+		for j := 0; j < tt.fast; j++ {
+			durations.WithLabelValues("/slo", http.MethodGet).Observe(0.1)
+		}
+		for j := 0; j < tt.slow; j++ {
+			durations.WithLabelValues("/slo", http.MethodPost).Observe(0.3)
+		}
+		durations.WithLabelValues("/unrelated", http.MethodGet).Observe(60)
+		slo.tick(collectPathBuckets(durations, "/slo"))
+		if got := metricValue(t, latencySLOBurnRate.WithLabelValues("/slo")); math.Abs(got-tt.burn) > 1e-9 {
+			t.Errorf("tick %d: burn rate %g, want %g", i+1, got, tt.burn)
+		}
+	}
+}
+
+func TestHistogramCountBelow(t *testing.T) {
+	// 10 observations up to 0.1s, 10 more up to 1s and 5 past the top bound
+	b := histogramBuckets{counts: map[float64]uint64{0.1: 10, 1: 20}, total: 25}
+	tests := []struct {
+		v, want float64
+	}{
+		{0, 0},
+		{0.05, 5},
+		{0.1, 10},
+		{0.55, 15},
+		{1, 20},
+		{10, 20},
+	}
+	for _, tt := range tests {
+		if got := b.countBelow(tt.v); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("countBelow(%g) = %g, want %g", tt.v, got, tt.want)
+		}
+	}
+}
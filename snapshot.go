@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Bumped whenever the snapshot layout changes; other versions are ignored on restore
+const snapshotVersion = 2
+
+var (
+	// Request and error counts restored from the previous run's snapshot.
+	// They are kept apart and only added back when saving, so requestCounter
+	// and errorCounter start from zero in every process for the rates and
+	// request-count triggers that read them.
+	restoredRequests, restoredErrors uint64
+)
+
+// Counter state persisted across restarts
+type metricsSnapshot struct {
+	Version        int                        `json:"version"`
+	Saved          time.Time                  `json:"saved"`
+	RequestCounter uint64                     `json:"request_counter"`
+	ErrorCounter   uint64                     `json:"error_counter"`
+	Counters       map[string][]counterSample `json:"counters"`
+}
+
+// One labelled series of a counter vec
+type counterSample struct {
+	Labels map[string]string `json:"labels"`
+	Value  float64           `json:"value"`
+}
+
+// Counter vec included in snapshots, with its label names in order
+type snapshotCounter struct {
+	vec    *prometheus.CounterVec
+	labels []string
+}
+
+// Counters included in snapshots, by metric name; built on use because
+// registration may swap the collectors
+func snapshotCounters() map[string]snapshotCounter {
+	return map[string]snapshotCounter{
+		"http_requests_total": {httpRequestsTotal, []string{"path", "method", "status", "cohort"}},
+	}
+}
+
+// Capture the current counter values
+func takeSnapshot() metricsSnapshot {
+	snap := metricsSnapshot{
+		Version:        snapshotVersion,
+		Saved:          time.Now().UTC(),
+		RequestCounter: restoredRequests + atomic.LoadUint64(&requestCounter),
+		ErrorCounter:   restoredErrors + atomic.LoadUint64(&errorCounter),
+		Counters:       map[string][]counterSample{},
+	}
+
+	for name, c := range snapshotCounters() {
+		ch := make(chan prometheus.Metric)
+		go func() {
+			c.vec.Collect(ch)
+			close(ch)
+		}()
+		for m := range ch {
+			var pb dto.Metric
+			if err := m.Write(&pb); err != nil {
+				continue
+			}
+			sample := counterSample{Labels: map[string]string{}, Value: pb.GetCounter().GetValue()}
+			for _, lp := range pb.GetLabel() {
+				sample.Labels[lp.GetName()] = lp.GetValue()
+			}
+			snap.Counters[name] = append(snap.Counters[name], sample)
+		}
+	}
+	return snap
+}
+
+// Write the snapshot atomically via a temporary file and rename
+func saveSnapshot(path string) error {
+	data, err := json.Marshal(takeSnapshot())
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".metrics-snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Seed the counters from a snapshot file; call before the background loops
+// start. A missing file is not an error;
+// snapshots of another version or with unknown series are skipped with a log
+// line rather than failing startup.
+func restoreSnapshot(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var snap metricsSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("decode %s: %w", path, err)
+	}
+	if snap.Version != snapshotVersion {
+		log.Printf("Ignoring metrics snapshot %s: version %d, expected %d", path, snap.Version, snapshotVersion)
+		return nil
+	}
+
+	restoredRequests = snap.RequestCounter
+	restoredErrors = snap.ErrorCounter
+
+	counters := snapshotCounters()
+	for name, samples := range snap.Counters {
+		c, ok := counters[name]
+		if !ok {
+			log.Printf("Ignoring unknown counter %s in metrics snapshot", name)
+			continue
+		}
+		for _, sample := range samples {
+			values := make([]string, len(c.labels))
+			for i, label := range c.labels {
+				v, ok := sample.Labels[label]
+				if !ok {
+					values = nil
+					break
+				}
+				values[i] = v
+			}
+			if values == nil || len(sample.Labels) != len(c.labels) || sample.Value < 0 {
+				log.Printf("Ignoring mismatched %s series %v in metrics snapshot", name, sample.Labels)
+				continue
+			}
+			c.vec.WithLabelValues(values...).Add(sample.Value)
+		}
+	}
+
+	log.Printf("Restored metrics snapshot from %s saved at %s", path, snap.Saved.Format(time.RFC3339))
+	return nil
+}
+
+// Save the snapshot periodically until ctx is done
+func runSnapshots(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := saveSnapshot(path); err != nil {
+				log.Printf("Failed to save metrics snapshot: %v", err)
+			}
+		}
+	}
+}
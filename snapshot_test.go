@@ -0,0 +1,52 @@
+package main
+
+import (
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// Restored totals are carried into the next snapshot without seeding the
+// per-process counters the triggers and rates read
+func TestSnapshotRoundTrip(t *testing.T) {
+	setVar(t, &restoredRequests, 0)
+	setVar(t, &restoredErrors, 0)
+	setVar(t, &requestCounter, 0)
+	setVar(t, &errorCounter, 0)
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	series := httpRequestsTotal.WithLabelValues("/snapshot-test", "GET", "200", "default")
+	before := metricValue(t, series)
+	series.Add(5)
+	atomic.StoreUint64(&requestCounter, 40)
+	atomic.StoreUint64(&errorCounter, 4)
+	if err := saveSnapshot(path); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	// As in a new process
+	atomic.StoreUint64(&requestCounter, 0)
+	atomic.StoreUint64(&errorCounter, 0)
+	if err := restoreSnapshot(path); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if n := atomic.LoadUint64(&requestCounter); n != 0 {
+		t.Errorf("requestCounter after restore = %d, want 0", n)
+	}
+	// The series lives on in this process, so restoring adds its value twice
+	if got, want := metricValue(t, series), 2*(before+5); got != want {
+		t.Errorf("restored series = %g, want %g", got, want)
+	}
+
+	atomic.StoreUint64(&requestCounter, 2)
+	snap := takeSnapshot()
+	if snap.RequestCounter != 42 || snap.ErrorCounter != 4 {
+		t.Errorf("next snapshot counters = %d requests, %d errors; want 42, 4", snap.RequestCounter, snap.ErrorCounter)
+	}
+}
+
+func TestRestoreSnapshotMissingFile(t *testing.T) {
+	if err := restoreSnapshot(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("restore of a missing file: %v", err)
+	}
+}
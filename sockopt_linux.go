@@ -0,0 +1,36 @@
+//go:build linux
+
+package main
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Set SO_REUSEPORT on a socket before it is bound
+func setReusePort(c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// Change the accept backlog of a listening socket. Go always listens with
+// the system maximum (net.core.somaxconn); listening again on the same
+// socket replaces the backlog, and values above somaxconn are capped by
+// the kernel.
+func setListenBacklog(c syscall.RawConn, backlog int) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = unix.Listen(int(fd), backlog)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Socket tuning is only supported on Linux, where the pods run
+func setReusePort(c syscall.RawConn) error {
+	return errors.New("SO_REUSEPORT is only supported on Linux")
+}
+
+func setListenBacklog(c syscall.RawConn, backlog int) error {
+	return errors.New("setting the listen backlog is only supported on Linux")
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Longest spike /admin/spike accepts
+const maxSpikeDuration = 10 * time.Minute
+
+var (
+	// End of the current latency spike in Unix nanoseconds; 0 or past means none
+	spikeUntil atomic.Int64
+
+	// Base /api latency while the spike lasts
+	spikeLatency atomic.Int64
+)
+
+// Latency of the active spike, if one is running at now
+func activeSpike(now time.Time) (time.Duration, bool) {
+	if now.UnixNano() >= spikeUntil.Load() {
+		return 0, false
+	}
+	return time.Duration(spikeLatency.Load()), true
+}
+
+// Report (GET) or start (POST/PUT ?duration=30s&latency=500ms) a one-shot
+// latency spike. For the duration, /api's base latency is raised to the
+// spike latency, then it reverts on its own; a new spike replaces the
+// running one.
+func adminSpikeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		q := r.URL.Query()
+		duration, err := time.ParseDuration(q.Get("duration"))
+		if err != nil || duration <= 0 || duration > maxSpikeDuration {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("duration must be a duration between 0 and %s", maxSpikeDuration))
+			return
+		}
+		latency, err := parseLatency(q.Get("latency"))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		until := time.Now().Add(duration).UnixNano()
+		spikeLatency.Store(int64(latency))
+		spikeUntil.Store(until)
+		logEvent(eventSpikeStarted, "Latency spike started", "latency", latency.String(), "duration", duration.String())
+		time.AfterFunc(duration, func() {
+			// Only the spike still in effect reports its end
+			if spikeUntil.Load() == until {
+				logEvent(eventSpikeEnded, "Latency spike ended")
+			}
+		})
+	}
+
+	status := map[string]any{"active": false}
+	if latency, ok := activeSpike(time.Now()); ok {
+		status = map[string]any{
+			"active":    true,
+			"latency":   latency.String(),
+			"remaining": time.Until(time.Unix(0, spikeUntil.Load())).Round(time.Millisecond).String(),
+		}
+	}
+	writeJSON(w, http.StatusOK, status)
+}
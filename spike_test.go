@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAdminSpike(t *testing.T) {
+	setAtomic(t, &spikeUntil, 0)
+	setAtomic(t, &spikeLatency, 0)
+	setAtomic(t, &apiLatency, int64(100*time.Millisecond))
+	setVar(t, &latencyPerQPS, 0)
+	rt := newTestRouter(t)
+
+	tests := []struct {
+		method, target string
+		status         int
+		active         bool
+		latency        time.Duration // effective /api latency afterwards
+	}{
+		{http.MethodGet, "/admin/spike", http.StatusOK, false, 100 * time.Millisecond},
+		{http.MethodPost, "/admin/spike?duration=1m", http.StatusBadRequest, false, 100 * time.Millisecond},
+		{http.MethodPost, "/admin/spike?duration=0s&latency=1s", http.StatusBadRequest, false, 100 * time.Millisecond},
+		{http.MethodPost, "/admin/spike?duration=11m&latency=1s", http.StatusBadRequest, false, 100 * time.Millisecond},
+		{http.MethodPost, "/admin/spike?duration=1m&latency=500ms", http.StatusOK, true, 500 * time.Millisecond},
+		{http.MethodGet, "/admin/spike", http.StatusOK, true, 500 * time.Millisecond},
+		// A spike below the base latency leaves the base in effect
+		{http.MethodPut, "/admin/spike?duration=1m&latency=50ms", http.StatusOK, true, 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		rec := serve(rt, tt.method, tt.target)
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: status %d, want %d: %s", tt.method, tt.target, rec.Code, tt.status, rec.Body)
+			continue
+		}
+		if rec.Code == http.StatusOK {
+			var status struct{ Active bool }
+			if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if status.Active != tt.active {
+				t.Errorf("%s %s: active = %v, want %v", tt.method, tt.target, status.Active, tt.active)
+			}
+		}
+		if got := effectiveAPILatency("/api"); got != tt.latency {
+			t.Errorf("after %s %s: /api latency %s, want %s", tt.method, tt.target, got, tt.latency)
+		}
+	}
+}
+
+// The spike reverts on its own once its duration is over
+func TestSpikeExpires(t *testing.T) {
+	setAtomic(t, &spikeUntil, 0)
+	setAtomic(t, &spikeLatency, 0)
+
+	serve(http.HandlerFunc(adminSpikeHandler), http.MethodPost, "/admin/spike?duration=30s&latency=1s")
+	now := time.Now()
+	tests := []struct {
+		at     time.Time
+		active bool
+	}{
+		{now, true},
+		{now.Add(29 * time.Second), true},
+		{now.Add(31 * time.Second), false},
+	}
+	for _, tt := range tests {
+		latency, ok := activeSpike(tt.at)
+		if ok != tt.active {
+			t.Errorf("%s in: active = %v, want %v", tt.at.Sub(now), ok, tt.active)
+		}
+		if ok && latency != time.Second {
+			t.Errorf("%s in: latency %s, want 1s", tt.at.Sub(now), latency)
+		}
+	}
+}
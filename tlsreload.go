@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Holds the current certificate; reloads swap it atomically so handshakes
+// in progress keep the certificate they started with
+type certHolder struct {
+	certFile, keyFile string
+
+	cert    atomic.Pointer[tls.Certificate]
+	modTime time.Time
+}
+
+func newCertHolder(certFile, keyFile string) (*certHolder, error) {
+	h := &certHolder{certFile: certFile, keyFile: keyFile}
+	if err := h.reload(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Load the key pair from disk; on error the previous certificate is kept
+func (h *certHolder) reload() error {
+	modTime, err := h.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(h.certFile, h.keyFile)
+	if err != nil {
+		return fmt.Errorf("load key pair: %w", err)
+	}
+	h.cert.Store(&cert)
+	h.modTime = modTime
+	return nil
+}
+
+// Newest modification time of the cert and key files
+func (h *certHolder) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{h.certFile, h.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// tls.Config.GetCertificate callback returning the current certificate
+func (h *certHolder) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return h.cert.Load(), nil
+}
+
+// Reload and log the outcome
+func (h *certHolder) reloadAndLog(reason string) {
+	err := h.reload()
+	recordReload(err)
+	if err != nil {
+		log.Printf("TLS certificate reload (%s) failed, keeping previous certificate: %v", reason, err)
+		return
+	}
+	log.Printf("TLS certificate reloaded (%s)", reason)
+}
+
+// Reload on SIGHUP or when either file changes; all reloads after startup
+// happen on this goroutine so modTime needs no locking
+func (h *certHolder) watch(ctx context.Context, interval time.Duration, sighup <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sighup:
+			h.reloadAndLog("SIGHUP")
+		case <-ticker.C:
+			modTime, err := h.latestModTime()
+			if err != nil {
+				log.Printf("TLS certificate check failed: %v", err)
+				continue
+			}
+			if modTime.After(h.modTime) {
+				h.reloadAndLog("file change")
+				// Don't retry a broken pair until the files change again
+				h.modTime = modTime
+			}
+		}
+	}
+}
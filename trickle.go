@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// Caps for /api?stream_bytes=&stream_rate=
+	maxStreamBytes    = 10 << 20
+	maxStreamDuration = time.Minute
+
+	// Interval between streamed chunks
+	streamTick = 100 * time.Millisecond
+
+	// Cap for /stream?chunks=
+	maxStreamChunks = 10000
+)
+
+// Parse /stream?chunks=N&delay=D, defaulting to 10 chunks 100ms apart
+func parseChunkedStream(r *http.Request) (chunks int, delay time.Duration, err error) {
+	q := r.URL.Query()
+	chunks, delay = 10, streamTick
+	if v := q.Get("chunks"); v != "" {
+		chunks, err = strconv.Atoi(v)
+		if err != nil || chunks < 1 || chunks > maxStreamChunks {
+			return 0, 0, fmt.Errorf("chunks must be between 1 and %d", maxStreamChunks)
+		}
+	}
+	if v := q.Get("delay"); v != "" {
+		delay, err = time.ParseDuration(v)
+		if err != nil || delay < 0 {
+			return 0, 0, fmt.Errorf("delay must be a non-negative duration like 200ms")
+		}
+	}
+	if d := time.Duration(chunks-1) * delay; d > maxStreamDuration {
+		return 0, 0, fmt.Errorf("stream would take %s, more than %s", d.Round(time.Second), maxStreamDuration)
+	}
+	return chunks, delay, nil
+}
+
+// Write chunks lines with delay between them, flushing each so proxies and
+// clients see a slow stream rather than one buffered response
+func streamHandler(w http.ResponseWriter, r *http.Request) {
+	chunks, delay, err := parseChunkedStream(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for i := 1; i <= chunks; i++ {
+		if _, err := fmt.Fprintf(w, "chunk %d/%d\n", i, chunks); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		if i == chunks {
+			return
+		}
+		timer.Reset(delay)
+		select {
+		case <-r.Context().Done():
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Parse ?stream_bytes= and ?stream_rate= (bytes per second); zero bytes means
+// no streaming. The rate defaults to sending everything in one second.
+func parseStream(r *http.Request) (size, rate int, err error) {
+	q := r.URL.Query()
+	if q.Get("stream_bytes") == "" {
+		return 0, 0, nil
+	}
+	size, err = strconv.Atoi(q.Get("stream_bytes"))
+	if err != nil || size < 1 || size > maxStreamBytes {
+		return 0, 0, fmt.Errorf("stream_bytes must be between 1 and %d", maxStreamBytes)
+	}
+	rate = size
+	if v := q.Get("stream_rate"); v != "" {
+		rate, err = strconv.Atoi(v)
+		if err != nil || rate < 1 {
+			return 0, 0, fmt.Errorf("stream_rate must be a positive number of bytes per second")
+		}
+	}
+	if d := time.Duration(float64(size) / float64(rate) * float64(time.Second)); d > maxStreamDuration {
+		return 0, 0, fmt.Errorf("stream would take %s, more than %s", d.Round(time.Second), maxStreamDuration)
+	}
+	return size, rate, nil
+}
+
+// Chunk size and interval that send rate bytes per second: a chunk every
+// streamTick, or single bytes further apart below 10 B/s. The interval is
+// derived from the whole chunk so rounding it down doesn't slow the stream.
+func streamPacing(rate int) (chunk int, tick time.Duration) {
+	// Beyond maxStreamBytes per tick any stream fits in one chunk; clamping
+	// first keeps the arithmetic from overflowing
+	perSecond := int(time.Second / streamTick)
+	rate = min(rate, maxStreamBytes*perSecond)
+	chunk = max(1, rate/perSecond)
+	return chunk, time.Duration(chunk) * time.Second / time.Duration(rate)
+}
+
+// Trickle size bytes at rate bytes per second, flushing after every chunk
+// and stopping when the client goes away or a write fails, e.g. on the
+// server's write timeout
+func writeStream(w http.ResponseWriter, r *http.Request, size, rate int) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(size))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	n, tick := streamPacing(rate)
+	chunk := bytes.Repeat([]byte("x"), min(n, size))
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for sent := 0; sent < size; {
+		n := min(len(chunk), size-sent)
+		if _, err := w.Write(chunk[:n]); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		sent += n
+		if sent == size {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
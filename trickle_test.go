@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamPacing(t *testing.T) {
+	tests := []struct {
+		rate  int
+		chunk int
+		tick  time.Duration
+	}{
+		{1, 1, time.Second},
+		{4, 1, 250 * time.Millisecond},
+		{10, 1, 100 * time.Millisecond},
+		{19, 1, time.Second / 19},
+		{1000, 100, 100 * time.Millisecond},
+		{1234, 123, 123 * time.Second / 1234},
+		{math.MaxInt, maxStreamBytes, streamTick},
+	}
+	for _, tt := range tests {
+		chunk, tick := streamPacing(tt.rate)
+		if chunk != tt.chunk || tick != tt.tick {
+			t.Errorf("streamPacing(%d) = %d bytes every %s, want %d every %s", tt.rate, chunk, tick, tt.chunk, tt.tick)
+		}
+	}
+}
+
+func TestWriteStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		rate     int
+		min, max time.Duration
+	}{
+		// Two bytes at 5 B/s: the second follows 200ms after the first
+		{"below 10 B/s", 2, 5, 190 * time.Millisecond, time.Second},
+		{"one tick", 40, 200, 90 * time.Millisecond, time.Second},
+		{"huge rate", 1 << 20, math.MaxInt, 0, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			start := time.Now()
+			writeStream(rec, httptest.NewRequest(http.MethodGet, "/api", nil), tt.size, tt.rate)
+			elapsed := time.Since(start)
+
+			if rec.Body.Len() != tt.size {
+				t.Errorf("streamed %d bytes, want %d", rec.Body.Len(), tt.size)
+			}
+			if elapsed < tt.min || elapsed > tt.max {
+				t.Errorf("stream took %s, want between %s and %s", elapsed, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestParseStream(t *testing.T) {
+	tests := []struct {
+		query      string
+		size, rate int
+		wantErr    bool
+	}{
+		{"", 0, 0, false},
+		{"stream_bytes=100", 100, 100, false},
+		{"stream_bytes=100&stream_rate=10", 100, 10, false},
+		{"stream_bytes=0", 0, 0, true},
+		{"stream_bytes=100&stream_rate=0", 0, 0, true},
+		{"stream_bytes=1000&stream_rate=1", 0, 0, true}, // over maxStreamDuration
+		{"stream_bytes=100&stream_rate=" + strconv.Itoa(math.MaxInt), 100, math.MaxInt, false},
+	}
+	for _, tt := range tests {
+		size, rate, err := parseStream(httptest.NewRequest(http.MethodGet, "/api?"+tt.query, nil))
+		if (err != nil) != tt.wantErr || size != tt.size || rate != tt.rate {
+			t.Errorf("parseStream(%q) = %d, %d, %v", tt.query, size, rate, err)
+		}
+	}
+}
+
+// Chunks reach a real client one at a time, delay apart, through the
+// middleware's responseWriter
+func TestStreamChunks(t *testing.T) {
+	srv := httptest.NewServer(newTestRouter(t))
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		query  string
+		status int
+		chunks int
+		delay  time.Duration
+	}{
+		{"chunks=3&delay=100ms", http.StatusOK, 3, 100 * time.Millisecond},
+		{"chunks=1&delay=1s", http.StatusOK, 1, 0},
+		{"chunks=5&delay=0s", http.StatusOK, 5, 0},
+		{"", http.StatusOK, 10, streamTick},
+		{"chunks=0", http.StatusBadRequest, 0, 0},
+		{"chunks=x", http.StatusBadRequest, 0, 0},
+		{"chunks=10001", http.StatusBadRequest, 0, 0},
+		{"delay=-1s", http.StatusBadRequest, 0, 0},
+		{"chunks=100&delay=1s", http.StatusBadRequest, 0, 0}, // over maxStreamDuration
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + "/stream?" + tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var arrivals []time.Time
+			sc := bufio.NewScanner(resp.Body)
+			for sc.Scan() {
+				arrivals = append(arrivals, time.Now())
+				if want := fmt.Sprintf("chunk %d/%d", len(arrivals), tt.chunks); sc.Text() != want {
+					t.Errorf("line %q, want %q", sc.Text(), want)
+				}
+			}
+			if len(arrivals) != tt.chunks {
+				t.Fatalf("%d chunks, want %d", len(arrivals), tt.chunks)
+			}
+			for i := 1; i < len(arrivals); i++ {
+				if gap := arrivals[i].Sub(arrivals[i-1]); gap < tt.delay*8/10 || gap > tt.delay+100*time.Millisecond {
+					t.Errorf("chunk %d arrived %s after the previous one, want about %s", i+1, gap, tt.delay)
+				}
+			}
+		})
+	}
+}
+
+// A cancelled client stops the stream at the next delay
+func TestStreamCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	streamHandler(rec, httptest.NewRequest(http.MethodGet, "/stream?chunks=5&delay=1s", nil).WithContext(ctx))
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("cancelled stream ran for %s", elapsed)
+	}
+	if got := strings.Count(rec.Body.String(), "\n"); got != 1 {
+		t.Errorf("%d chunks written before cancellation, want 1", got)
+	}
+}
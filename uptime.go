@@ -0,0 +1,20 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// When the process started, for /uptime. process_start_time_seconds itself
+// is exported by the process collector registered in registerMetrics.
+var processStartTime = time.Now()
+
+// Report the start time and uptime, to spot restarts and counter resets
+func uptimeHandler(w http.ResponseWriter, r *http.Request) {
+	uptime := time.Since(processStartTime)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"start_time":     processStartTime.UTC().Format(time.RFC3339),
+		"uptime":         uptime.Round(time.Millisecond).String(),
+		"uptime_seconds": uptime.Seconds(),
+	})
+}
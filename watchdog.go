@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// How often the watchdog checks heartbeats, and how late a loop may be
+	// beyond its own interval before it counts as stalled
+	watchdogInterval  = 5 * time.Second
+	watchdogThreshold = 30 * time.Second
+
+	// Set once a background loop stalls; liveness fails from then on so the
+	// pod gets restarted
+	stalled atomic.Bool
+
+	heartbeatsMu sync.Mutex
+	heartbeats   []*heartbeat
+)
+
+// Last tick of a background loop that is expected to tick every interval
+type heartbeat struct {
+	name     string
+	interval time.Duration
+	last     atomic.Int64
+}
+
+// Register a heartbeat for a loop; call beat on every tick
+func newHeartbeat(name string, interval time.Duration) *heartbeat {
+	hb := &heartbeat{name: name, interval: interval}
+	hb.beat()
+
+	heartbeatsMu.Lock()
+	heartbeats = append(heartbeats, hb)
+	heartbeatsMu.Unlock()
+	return hb
+}
+
+func (hb *heartbeat) beat() {
+	hb.last.Store(time.Now().UnixNano())
+}
+
+// Time since the last beat
+func (hb *heartbeat) age(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, hb.last.Load()))
+}
+
+// Watchdog runs in background, failing liveness when any loop stops ticking
+func runWatchdog(ctx context.Context) {
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			heartbeatsMu.Lock()
+			for _, hb := range heartbeats {
+				if age := hb.age(now); age > hb.interval+watchdogThreshold && !stalled.Swap(true) {
+					slog.Error("Background loop stalled, failing liveness", "event", eventLoopStalled, "loop", hb.name, "since", age.String())
+				}
+			}
+			heartbeatsMu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Gauge for the fraction of pool workers busy with a request
+	workerPoolUtilization = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "worker_pool_utilization",
+			Help: "Fraction of /api worker pool workers currently busy",
+		},
+	)
+
+	// Gauge for requests waiting in the pool queue
+	workerPoolQueueDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "worker_pool_queue_depth",
+			Help: "Number of /api requests waiting for a pool worker",
+		},
+	)
+
+	// Histogram for the time requests wait in the queue before a worker picks them up
+	workerQueueWait = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "worker_queue_wait_seconds",
+			Help:    "Time /api requests wait in the worker pool queue in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+	)
+
+	// Counter for requests rejected because the queue was full; these never wait
+	workerPoolRejectedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "worker_pool_rejected_total",
+			Help: "Total number of /api requests rejected because the worker pool queue was full",
+		},
+	)
+
+	// Pool serving /api when WORKER_POOL_SIZE is set, nil for inline handling
+	apiPool *workerPool
+)
+
+// A unit of work and the channel closed once it ran
+type poolJob struct {
+	run      func()
+	done     chan struct{}
+	enqueued time.Time
+}
+
+// Fixed number of workers fed from a bounded queue
+type workerPool struct {
+	size int
+	jobs chan poolJob
+	busy atomic.Int64
+}
+
+func newWorkerPool(size, queue int) *workerPool {
+	return &workerPool{size: size, jobs: make(chan poolJob, queue)}
+}
+
+// Start the workers; they exit when ctx is done
+func (p *workerPool) start(ctx context.Context) {
+	for i := 0; i < p.size; i++ {
+		startBackground(func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-p.jobs:
+					workerQueueWait.Observe(secondsSince(job.enqueued))
+					workerPoolQueueDepth.Set(float64(len(p.jobs)))
+					p.setBusy(p.busy.Add(1))
+					job.run()
+					p.setBusy(p.busy.Add(-1))
+					close(job.done)
+				}
+			}
+		})
+	}
+}
+
+func (p *workerPool) setBusy(busy int64) {
+	workerPoolUtilization.Set(float64(busy) / float64(p.size))
+}
+
+// Queue fn and wait for a worker to run it; returns false without running
+// fn when the queue is full
+func (p *workerPool) do(fn func()) bool {
+	job := poolJob{run: fn, done: make(chan struct{}), enqueued: time.Now()}
+	select {
+	case p.jobs <- job:
+		workerPoolQueueDepth.Set(float64(len(p.jobs)))
+	default:
+		workerPoolRejectedTotal.Inc()
+		return false
+	}
+	// Always wait: the job writes to the response, which must not outlive the handler
+	<-job.done
+	return true
+}
+
+// Whether the queue is full, so new work would be rejected
+func (p *workerPool) full() bool {
+	return cap(p.jobs) > 0 && len(p.jobs) == cap(p.jobs)
+}
+
+// Dispatch the handler to apiPool when pooling is enabled
+func pooled(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if apiPool == nil {
+			next(w, r)
+			return
+		}
+		ok := apiPool.do(func() {
+			// Skip the work if the client gave up while queued
+			if r.Context().Err() != nil {
+				return
+			}
+			// The work runs on this worker's goroutine, not the handler's
+			defer trackCPU(r.Context())()
+			next(w, r)
+		})
+		if !ok {
+			writeUnavailable(w, "queue_full", "worker pool queue full")
+		}
+	}
+}